@@ -2,10 +2,12 @@ package acmetools
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"net"
 	"os"
 	"os/exec"
@@ -14,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/knusbaum/go9p/client"
 	"github.com/knusbaum/go9p/proto"
@@ -120,6 +123,33 @@ func (a *Acme) GetWindow(id string) (*Window, error) {
 	return &Window{c: a.c, id: id}, nil
 }
 
+// LookupWindow returns a handle to an existing window whose name (the first word of its tag) is
+// name. If no such window exists, LookupWindow returns nil and a nil error.
+func (a *Acme) LookupWindow(name string) (*Window, error) {
+	f, err := a.c.Open("/index", proto.Oread)
+	if err != nil {
+		return nil, fmt.Errorf("Tried to open index file, but failed: %w", err)
+	}
+	defer f.Close()
+	bs, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(bs), "\n") {
+		// Each line of the index holds the same 5 numbers as a window's ctl file, followed
+		// by the window's tag.
+		ps, err := parseWinParams(line)
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(line[60:])
+		if len(fields) > 0 && fields[0] == name {
+			return &Window{c: a.c, id: fmt.Sprintf("%d", ps.ID)}, nil
+		}
+	}
+	return nil, nil
+}
+
 // Log accepts a format string and arguments, which will be formatted according to the fmt package.
 // This will be written to a window labeled `+Errors`.
 func (a *Acme) Log(f string, args ...interface{}) error {
@@ -141,7 +171,7 @@ type Window struct {
 
 	addr *client.File
 	ctl  *client.File
-	//data *client.File
+	data *client.File
 	body *client.File
 }
 
@@ -149,7 +179,10 @@ type Window struct {
 // `event` file. Events should be read from the chan C.
 type EventStream struct {
 	C chan *Event
-	f *client.File
+	f io.ReadWriteCloser
+	w *Window
+
+	keys map[rune][]KeyHook
 }
 
 // Origin is used to identify the source of an Event.
@@ -345,54 +378,50 @@ type Event struct {
 // For messages with the 1 bit on in the flag, writing the message back to the event file, but with
 // the flag, count, and text omitted, will cause the action to be applied to the file exactly as it
 // would have been if the event file had not been open.
-func parseEvent(r *bufio.Reader) (*Event, error) {
-	var b [2]byte
-	_, err := r.Read(b[:])
-	if err != nil {
-		return nil, err
-	}
-	origin := parseOrigin(rune(b[0]))
-	aType := parseEType(rune(b[1]))
-
-	s, err := r.ReadString(' ')
+func parseEvent(r eventReader) (*Event, error) {
+	o, err := r.ReadByte()
 	if err != nil {
 		return nil, err
 	}
-	saddr, err := strconv.Atoi(strings.TrimSpace(s))
-	if err != nil {
-		panic(err)
-	}
-	s, err = r.ReadString(' ')
+	t, err := r.ReadByte()
 	if err != nil {
 		return nil, err
 	}
-	eaddr, err := strconv.Atoi(strings.TrimSpace(s))
-	if err != nil {
-		panic(err)
-	}
-	s, err = r.ReadString(' ')
-	if err != nil {
-		return nil, err
+	origin := parseOrigin(rune(o))
+	aType := parseEType(rune(t))
+
+	var nums [4]int
+	for i := range nums {
+		s, err := r.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+		nums[i], err = strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("Bad event: %w", err)
+		}
 	}
-	flag, err := strconv.Atoi(strings.TrimSpace(s))
-	if err != nil {
-		panic(err)
+	saddr, eaddr, flag, nchars := nums[0], nums[1], nums[2], nums[3]
+
+	// The count is of characters (runes), not bytes.
+	var bs []byte
+	for i := 0; i < nchars; i++ {
+		start := len(bs)
+		for len(bs) == start || !utf8.FullRune(bs[start:]) {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			bs = append(bs, b)
+		}
 	}
-	s, err = r.ReadString(' ')
+	nl, err := r.ReadByte()
 	if err != nil {
 		return nil, err
 	}
-	nchars, err := strconv.Atoi(strings.TrimSpace(s))
-	if err != nil {
-		panic(err)
-	}
-
-	bs := make([]byte, nchars)
-	_, err = r.Read(bs)
-	if err != nil {
-		return nil, err
+	if nl != '\n' {
+		return nil, fmt.Errorf("Bad event: expected newline after text, but found %q", nl)
 	}
-	r.ReadByte()
 	return &Event{
 		Origin:    origin,
 		Type:      aType,
@@ -433,6 +462,43 @@ func (e *Event) String() string {
 	return fmt.Sprintf("%c%c%d %d %d %d %s", e.Origin.Char(), e.Type.Char(), e.StartAddr, e.EndAddr, e.Flag, e.NChars, e.S)
 }
 
+// MarshalText encodes the event in the format acme(4) uses for messages read from the event file,
+// including the trailing newline. The character count is always the number of runes in S, so an
+// event whose text was elided by acme is encoded with a count of 0.
+//
+// Since Event implements encoding.TextMarshaler and encoding.TextUnmarshaler, encoding/json
+// encodes an Event or *Event as a JSON string holding this format. The receiver is a value so
+// that events that aren't addressable, such as those in a map, are encoded the same way.
+func (e Event) MarshalText() ([]byte, error) {
+	if e.Origin.Char() == '?' {
+		return nil, fmt.Errorf("Bad event origin %d", e.Origin)
+	}
+	if e.Type.Char() == '?' {
+		return nil, fmt.Errorf("Bad event type %d", e.Type)
+	}
+	return []byte(fmt.Sprintf("%c%c%d %d %d %d %s\n", e.Origin.Char(), e.Type.Char(), e.StartAddr, e.EndAddr, e.Flag, utf8.RuneCountInString(e.S), e.S)), nil
+}
+
+// UnmarshalText decodes a single event in the format produced by MarshalText.
+func (e *Event) UnmarshalText(text []byte) error {
+	r := bufio.NewReader(bytes.NewReader(text))
+	ev, err := parseEvent(r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if r.Buffered() > 0 {
+		return fmt.Errorf("Bad event: %d bytes of trailing data", r.Buffered())
+	}
+	if ev.Origin.Char() == '?' || ev.Type.Char() == '?' {
+		return fmt.Errorf("Bad event: unknown origin or type %q", text[:2])
+	}
+	*e = *ev
+	return nil
+}
+
 // This causes the event to be written back to the event file, according to acme(4).
 //
 // For events where IsBuiltin() == true, writing the message back will cause the action to be
@@ -442,6 +508,27 @@ func (e *EventStream) WriteBack(ev *Event) error {
 	return err
 }
 
+// SkipChord reads and discards the 2 events that follow ev reporting its argument, if ev is
+// Chorded. It is for programs that don't use the argument.
+func (e *EventStream) SkipChord(ev *Event) {
+	if ev.Chorded() {
+		<-e.C
+		<-e.C
+	}
+}
+
+// Write writes the complete event to the stream, in the format read from the event file. This is
+// for streams made with NewEventStream, such as an event proxy sending synthetic events to its
+// clients. Acme itself only accepts the shorter format written by WriteBack.
+func (e *EventStream) Write(ev *Event) error {
+	bs, err := ev.MarshalText()
+	if err != nil {
+		return err
+	}
+	_, err = e.f.Write(bs)
+	return err
+}
+
 // Close closes the event stream, returning control of the window to Acme.
 func (e *EventStream) Close() error {
 	fmt.Printf("Closing Event Stream.\n")
@@ -458,39 +545,85 @@ func (w *Window) Close() error {
 		w.ctl.Close()
 		w.ctl = nil
 	}
+	if w.data != nil {
+		w.data.Close()
+		w.data = nil
+	}
+	if w.body != nil {
+		w.body.Close()
+		w.body = nil
+	}
 	return nil
 }
 
+// ID returns the window's numeric ID, as used in acme's file system and $winid.
+func (w *Window) ID() string {
+	return w.id
+}
+
 // Events returns an EventStream which can be used by applications to handle
 // window events. Please see EventStream and acme(4) for more details.
 func (w *Window) Events() (*EventStream, error) {
-	c := make(chan *Event, 100)
+	return w.events(nil)
+}
 
+// RecordEvents is like Events, but also saves every event, along with a snapshot of the window's
+// body taken as the event arrives, to rec. See Recorder.
+func (w *Window) RecordEvents(rec *Recorder) (*EventStream, error) {
+	return w.events(rec)
+}
+
+func (w *Window) events(rec *Recorder) (*EventStream, error) {
 	f, err := w.c.Open(fmt.Sprintf("/%s/event", w.id), proto.Ordwr)
 	if err != nil {
 		return nil, fmt.Errorf("Tried to open event file, but failed: %w", err)
 	}
+	var record func(raw []byte)
+	if rec != nil {
+		record = func(raw []byte) {
+			err := w.record(rec, raw)
+			if err != nil {
+				log.Printf("Failed to record event: %v", err)
+			}
+		}
+	}
+	return newEventStream(f, w, record), nil
+}
+
+// NewEventStream returns an EventStream that reads events in the format of acme's event file from
+// rw, and writes events to rw. It can be used to build event proxies, or to test event handling
+// without acme.
+func NewEventStream(rw io.ReadWriteCloser) *EventStream {
+	return newEventStream(rw, nil, nil)
+}
+
+func newEventStream(f io.ReadWriteCloser, w *Window, record func(raw []byte)) *EventStream {
+	c := make(chan *Event, 100)
 
 	go func() {
 		defer fmt.Printf("Shutting down event stream.\n")
 		defer close(c)
-		r := bufio.NewReader(f)
+		r := &recordingReader{Reader: bufio.NewReader(f)}
 		for {
 			// 			s, err := r.ReadString('\n')
 			// 			if err != nil {
 			// 				log.Printf("Failed to read events file: %v", err)
 			// 				return
 			// 			}
+			r.raw = r.raw[:0]
 			e, err := parseEvent(r)
 			if err != nil {
 				log.Printf("Failed to read events file: %v", err)
 				return
 			}
+			if record != nil {
+				record(r.raw)
+			}
 			c <- e
 		}
 	}()
 
-	return &EventStream{C: c, f: f}, nil
+	return &EventStream{C: c, f: f, w: w}
 }
 
 // WinParams represents the 5 parameters read from the Window's ctl file.
@@ -553,7 +686,8 @@ func (w *Window) ReadCtl() (WinParams, error) {
 		w.ctl = f
 	}
 
-	bs, err := io.ReadAll(w.ctl)
+	// Read from the start of the file every time, so the ctl file can be read more than once.
+	bs, err := io.ReadAll(io.NewSectionReader(w.ctl, 0, math.MaxInt64))
 	if err != nil {
 		return WinParams{}, err
 	}
@@ -621,6 +755,65 @@ func (w *Window) Addr() (q0 int, q1 int, err error) {
 	return q0, q1, nil
 }
 
+// Replace replaces the text at address a with s. The address can be any format understood by
+// WriteAddr.
+func (w *Window) Replace(a string, s string) error {
+	// Make sure addr is open
+	_, _, err := w.Addr()
+	if err != nil {
+		return err
+	}
+	err = w.WriteAddr(a)
+	if err != nil {
+		return err
+	}
+	if s == "" {
+		// Zero-length writes never reach acme, so delete the text by selecting it and opening
+		// wrsel, which cuts the selection.
+		err = w.Ctl("dot=addr")
+		if err != nil {
+			return err
+		}
+		f, err := w.c.Open(fmt.Sprintf("/%s/wrsel", w.id), proto.Owrite)
+		if err != nil {
+			return fmt.Errorf("Tried to open wrsel file, but failed: %w", err)
+		}
+		return f.Close()
+	}
+	if w.data == nil {
+		f, err := w.c.Open(fmt.Sprintf("/%s/data", w.id), proto.Ordwr)
+		if err != nil {
+			return fmt.Errorf("Tried to open data file, but failed: %w", err)
+		}
+		w.data = f
+	}
+	_, err = io.WriteString(w.data, s)
+	return err
+}
+
+// ReadAddr returns the text at address a. The address can be any format understood by WriteAddr.
+func (w *Window) ReadAddr(a string) (string, error) {
+	// Make sure addr is open
+	_, _, err := w.Addr()
+	if err != nil {
+		return "", err
+	}
+	err = w.WriteAddr(a)
+	if err != nil {
+		return "", err
+	}
+	xd, err := w.XData()
+	if err != nil {
+		return "", err
+	}
+	defer xd.Close()
+	bs, err := io.ReadAll(xd)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
 // XData returns a new handle to the window's xdata file, which will return data
 // according to the address set by WriteAddr.
 func (w *Window) XData() (io.ReadWriteCloser, error) {
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/knusbaum/acmetools"
+)
+
+func main() {
+	flag.Parse()
+
+	winid := os.Getenv("winid")
+	if winid == "" {
+		log.Fatalf("Could not find acme window. $winid not set.")
+	}
+
+	a, err := acmetools.NewAcme()
+	if err != nil {
+		log.Fatalf("Failed to connect to acme: %v", err)
+	}
+
+	w, err := a.GetWindow(winid)
+	if err != nil {
+		log.Fatalf("Failed to get window: %v", err)
+	}
+	defer w.Close()
+
+	es, err := w.Events()
+	if err != nil {
+		log.Fatalf("Failed to get events stream: %v", err)
+	}
+	defer es.Close()
+
+	es.OnKey('\n', indent)
+
+	for e := range es.C {
+		if e.HasExpansion() {
+			nexte := <-es.C
+			e.NChars = nexte.NChars
+			e.S = nexte.S
+		}
+		// The argument and its origin aren't used.
+		es.SkipChord(e)
+		_, err := es.HandleKey(e)
+		if err != nil {
+			log.Printf("Failed to indent: %v", err)
+		}
+		switch e.Type {
+		case acmetools.ET_BodyBtn2, acmetools.ET_TagBtn2, acmetools.ET_BodyBtn3, acmetools.ET_TagBtn3:
+			// We only care about typing, so let acme handle everything else.
+			es.WriteBack(e)
+		}
+	}
+}
+
+// indent starts the new line with the same leading whitespace as the line before it, plus a tab
+// if that line opens a block.
+func indent(kc acmetools.KeyContext) (acmetools.KeyEdit, bool) {
+	prefix := kc.LinePrefix
+	ws := prefix[:len(prefix)-len(strings.TrimLeft(prefix, " \t"))]
+	if strings.HasSuffix(strings.TrimSpace(prefix), "{") {
+		ws += "\t"
+	}
+	if ws == "" {
+		return acmetools.KeyEdit{}, false
+	}
+	return acmetools.KeyEdit{Text: ws, Dot: utf8.RuneCountInString(ws)}, true
+}
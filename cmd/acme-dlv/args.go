@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitArgs splits s into words separated by white space. As in rc(1), a word may be quoted with
+// single quotes, and a quote inside a quoted word is written as two quotes.
+func splitArgs(s string) []string {
+	var args []string
+	var b strings.Builder
+	inWord := false
+	quoted := false
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case quoted && r == '\'':
+			if i+1 < len(rs) && rs[i+1] == '\'' {
+				b.WriteRune('\'')
+				i++
+			} else {
+				quoted = false
+			}
+		case quoted:
+			b.WriteRune(r)
+		case r == '\'':
+			quoted = true
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				args = append(args, b.String())
+				b.Reset()
+				inWord = false
+			}
+		default:
+			b.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, b.String())
+	}
+	return args
+}
+
+// firstArg splits the first word from s, as splitArgs would split it, and returns it with the
+// rest of s after the white space following it. The rest is left as it is, quotes and all.
+func firstArg(s string) (string, string) {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	quoted := false
+	end := len(s)
+	for i, r := range s {
+		if r == '\'' {
+			// A doubled quote inside a quoted word toggles twice, which leaves it quoted.
+			quoted = !quoted
+		} else if !quoted && unicode.IsSpace(r) {
+			end = i
+			break
+		}
+	}
+	args := splitArgs(s[:end])
+	if len(args) == 0 {
+		return "", ""
+	}
+	return args[0], strings.TrimLeftFunc(s[end:], unicode.IsSpace)
+}
+
+// quoteArg quotes s so that splitArgs will return it as a single word.
+func quoteArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, "' \t\n") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// joinArgs quotes each of args and joins them with spaces.
+func joinArgs(args []string) string {
+	qs := make([]string, len(args))
+	for i, a := range args {
+		qs[i] = quoteArg(a)
+	}
+	return strings.Join(qs, " ")
+}
+
+// splitAssign splits an assignment "lhs = rhs" at its '=', which is the first one outside of
+// brackets and quotes that isn't part of an operator such as "==" or "<=".
+func splitAssign(s string) (string, string, bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == '=' && depth == 0:
+			if i > 0 && strings.IndexByte("=!<>:", s[i-1]) >= 0 {
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '=' {
+				i++
+				continue
+			}
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		args []string
+	}{
+		{
+			in:   "",
+			args: nil,
+		},
+		{
+			in:   "  a b\tc  ",
+			args: []string{"a", "b", "c"},
+		},
+		{
+			in:   "'a b' c",
+			args: []string{"a b", "c"},
+		},
+		{
+			in:   "'it''s' x",
+			args: []string{"it's", "x"},
+		},
+		{
+			in:   "a'b c'd",
+			args: []string{"ab cd"},
+		},
+		{
+			in:   "'' x",
+			args: []string{"", "x"},
+		},
+		{
+			in:   "'unterminated",
+			args: []string{"unterminated"},
+		},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			if args := splitArgs(tt.in); !reflect.DeepEqual(args, tt.args) {
+				t.Fatalf("Expected %q, but got %q", tt.args, args)
+			}
+		})
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		out string
+	}{
+		{
+			in:  "plain",
+			out: "plain",
+		},
+		{
+			in:  "",
+			out: "''",
+		},
+		{
+			in:  "a b",
+			out: "'a b'",
+		},
+		{
+			in:  "it's",
+			out: "'it''s'",
+		},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			out := quoteArg(tt.in)
+			if out != tt.out {
+				t.Fatalf("Expected %s, but got %s", tt.out, out)
+			}
+			if args := splitArgs(out); len(args) != 1 || args[0] != tt.in {
+				t.Fatalf("Expected %s to split back into [%s], but got %q", out, tt.in, args)
+			}
+		})
+	}
+}
+
+func TestJoinArgs(t *testing.T) {
+	args := []string{"-test.run", "^TestFoo$/^with space$", "", "it's"}
+	if out := splitArgs(joinArgs(args)); !reflect.DeepEqual(out, args) {
+		t.Fatalf("Expected %q, but got %q", args, out)
+	}
+}
+
+func TestSplitAssign(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		lhs string
+		rhs string
+		ok  bool
+	}{
+		{in: "x = 1", lhs: "x", rhs: "1", ok: true},
+		{in: "x=1", lhs: "x", rhs: "1", ok: true},
+		{in: `m["a=b"] = 1`, lhs: `m["a=b"]`, rhs: "1", ok: true},
+		{in: `m['='] = 'x'`, lhs: `m['=']`, rhs: "'x'", ok: true},
+		{in: "m[`a\"=`] = 2", lhs: "m[`a\"=`]", rhs: "2", ok: true},
+		{in: `s["\"="] = 3`, lhs: `s["\"="]`, rhs: "3", ok: true},
+		{in: "a[i==j] = b == c", lhs: "a[i==j]", rhs: "b == c", ok: true},
+		{in: "f(x=1).y = 2", lhs: "f(x=1).y", rhs: "2", ok: true},
+		{in: "x == 1", ok: false},
+		{in: "x <= 1", ok: false},
+		{in: "x", ok: false},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			lhs, rhs, ok := splitAssign(tt.in)
+			if lhs != tt.lhs || rhs != tt.rhs || ok != tt.ok {
+				t.Fatalf("Expected (%q, %q, %v), but got (%q, %q, %v)", tt.lhs, tt.rhs, tt.ok, lhs, rhs, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/knusbaum/acmetools"
+)
+
+// An auxWindow is a window a session opens to show more about the target, such as its goroutines.
+//
+// Get refills the window. Button 2 on a number, decimal or hex, runs the window's command for that
+// number, such as "Goroutine 17" or "Disasm 0x4a1b20", and any other button 2 command is run by
+// the session as though it had been clicked in the session's window. In most windows the numbers
+// are IDs in the first column, and only a number leading its line counts, so that a click on a
+// line number in a file:line is plumbed as usual.
+type auxWindow struct {
+	ow   *acmetools.OutputWindow
+	done chan struct{} // Closed once the window's events stop, when it has been deleted.
+
+	mu       sync.Mutex
+	get      string // The command that fills the window.
+	number   string // The command a number clicked in the window is given to.
+	anywhere bool   // Whether a number anywhere is given to number, rather than only a leading one.
+	body     []rune // The text shown in the window.
+}
+
+// command returns the command to run for a button 2 click on text in the window, at q in the body
+// if q is not negative. It returns "" if the click is not a command, and should be written back.
+func (w *auxWindow) command(text string, q int) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if text == "Get" {
+		return w.get
+	}
+	if _, err := strconv.ParseUint(text, 0, 64); err == nil && w.number != "" {
+		if w.anywhere || (q >= 0 && leadsLine(w.body, q)) {
+			return w.number + " " + text
+		}
+		return ""
+	}
+	return text
+}
+
+// leadsLine reports whether the word around q in text is the first on its line, after any mark
+// such as the '*' of the current goroutine.
+func leadsLine(text []rune, q int) bool {
+	if q > len(text) {
+		return false
+	}
+	for q > 0 && (unicode.IsLetter(text[q-1]) || unicode.IsDigit(text[q-1])) {
+		q--
+	}
+	for q > 0 && text[q-1] != '\n' {
+		q--
+		if !strings.ContainsRune(" \t*=>", text[q]) {
+			return false
+		}
+	}
+	return true
+}
+
+// auxWindows are the auxiliary windows of a session.
+type auxWindows struct {
+	a    *acmetools.Acme
+	s    *Session
+	wins map[string]*auxWindow
+}
+
+func newAuxWindows(a *acmetools.Acme, s *Session) *auxWindows {
+	return &auxWindows{a: a, s: s, wins: make(map[string]*auxWindow)}
+}
+
+// Show replaces the body of the session's window called kind with text, opening the window with
+// tag added to its tag if it isn't open. get is the command that fills the window, and number is
+// the command a number clicked in the window is given to, if any: a number anywhere if anywhere
+// is set, and otherwise only one leading its line.
+func (aw *auxWindows) Show(kind, tag, get, number string, anywhere bool, text string) error {
+	w, ok := aw.wins[kind]
+	if ok {
+		select {
+		case <-w.done:
+			ok = false
+		default:
+		}
+	}
+	if !ok {
+		var err error
+		w, err = aw.open(kind, tag)
+		if err != nil {
+			return err
+		}
+		aw.wins[kind] = w
+	}
+	w.mu.Lock()
+	w.get = get
+	w.number = number
+	w.anywhere = anywhere
+	w.body = []rune(text)
+	w.mu.Unlock()
+	win := w.ow.Window()
+	err := win.Replace(",", text)
+	if err != nil {
+		return err
+	}
+	err = win.Ctl("clean")
+	if err != nil {
+		return err
+	}
+	// Show the top of the window.
+	_, _, err = win.Addr()
+	if err != nil {
+		return err
+	}
+	err = win.WriteAddr("#0")
+	if err != nil {
+		return err
+	}
+	err = win.Ctl("dot=addr")
+	if err != nil {
+		return err
+	}
+	return win.Ctl("show")
+}
+
+func (aw *auxWindows) open(kind, tag string) (*auxWindow, error) {
+	ow, err := aw.a.OutputWindow(aw.s.Name + "/" + kind)
+	if err != nil {
+		return nil, err
+	}
+	win := ow.Window()
+	win.Ctl("cleartag")
+	win.AppendTag(" Get" + tag)
+	es, err := win.Events()
+	if err != nil {
+		ow.Close()
+		return nil, err
+	}
+	w := &auxWindow{ow: ow, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		defer es.Close()
+		for e := range es.C {
+			if e.HasExpansion() {
+				nexte := <-es.C
+				e.NChars = nexte.NChars
+				e.S = nexte.S
+			}
+			// The argument and its origin aren't used.
+			es.SkipChord(e)
+			switch e.Type {
+			case acmetools.ET_BodyBtn2, acmetools.ET_TagBtn2:
+				text := strings.TrimSpace(e.S)
+				if e.IsBuiltin() && text != "Get" {
+					es.WriteBack(e)
+					continue
+				}
+				q := -1
+				if e.Type == acmetools.ET_BodyBtn2 {
+					q = e.StartAddr
+				}
+				cmd := w.command(text, q)
+				if cmd == "" {
+					es.WriteBack(e)
+					continue
+				}
+				select {
+				case aw.s.Cmds <- &Request{Cmd: cmd}:
+				default:
+				}
+			case acmetools.ET_BodyBtn3, acmetools.ET_TagBtn3:
+				es.WriteBack(e)
+			}
+		}
+	}()
+	return w, nil
+}
+
+// Refresh refills the session's window called kind, if it is open, by running its command again.
+func (aw *auxWindows) Refresh(kind string) {
+	w, ok := aw.wins[kind]
+	if !ok {
+		return
+	}
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	select {
+	case aw.s.Cmds <- &Request{Cmd: w.command("Get", -1)}:
+	default:
+	}
+}
+
+// Close deletes the session's auxiliary windows.
+func (aw *auxWindows) Close() {
+	for _, w := range aw.wins {
+		w.ow.Window().Ctl("delete")
+		w.ow.Close()
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLeadsLine(t *testing.T) {
+	const text = "2 goroutines\n\n* 1\tsyscall\t/m/main.go:12 main.main\tstart /m/main.go:3 main.main\tk=7\n  17\twaiting\t/m/x.go:40 main.f\n=>\t0x4a1b20\tCALL\t0x4a1c00\n"
+	for _, tt := range []struct {
+		word  string // The first occurrence of word in text is clicked.
+		leads bool
+	}{
+		{word: "1\t", leads: true},
+		{word: "17", leads: true},
+		{word: "12 ", leads: false},
+		{word: "7\n", leads: false},
+		{word: "40", leads: false},
+		{word: "0x4a1b20", leads: true},
+		{word: "0x4a1c00", leads: false},
+		{word: "2 goroutines", leads: true},
+	} {
+		t.Run(tt.word, func(t *testing.T) {
+			q := len([]rune(text[:strings.Index(text, tt.word)]))
+			// Clicks both at the start and in the middle of the word.
+			for _, at := range []int{q, q + 1} {
+				if leads := leadsLine([]rune(text), at); leads != tt.leads {
+					t.Fatalf("Expected %v at %d, but got %v", tt.leads, at, leads)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// BreakOpts are the options of a breakpoint beyond its location:
+//
+//	-c cond      stop only when cond is true
+//	-h hitcond   stop only when the hit count satisfies hitcond, such as "> 10" or "% 2"
+//	-trace       print the function and its arguments instead of stopping
+//	-log msg     print msg instead of stopping, with each {expr} replaced by the value of expr
+type BreakOpts struct {
+	Cond    string
+	HitCond string
+	Trace   bool
+	Log     string
+}
+
+// parseBreakOpts parses the options at the start of args, and returns the remaining arguments.
+func parseBreakOpts(args []string) (BreakOpts, []string, error) {
+	var o BreakOpts
+	for len(args) > 0 {
+		switch args[0] {
+		case "-c", "-h", "-log":
+			if len(args) < 2 {
+				return o, nil, fmt.Errorf("%s needs an argument.", args[0])
+			}
+			switch args[0] {
+			case "-c":
+				o.Cond = args[1]
+			case "-h":
+				o.HitCond = args[1]
+			case "-log":
+				o.Log = args[1]
+			}
+			args = args[2:]
+		case "-trace":
+			o.Trace = true
+			args = args[1:]
+		default:
+			return o, args, nil
+		}
+	}
+	return o, args, nil
+}
+
+// parseCond parses the arguments of Cond:
+//
+//	Cond <breakpoint> [-h hitcond] [condition]
+//
+// The condition is the rest of the text as it was given, so it keeps its spacing and quotes. An
+// empty condition or hit condition removes it.
+func parseCond(text string) (id int, hitCond, cond string, err error) {
+	arg, rest := firstArg(text)
+	if arg == "" {
+		return 0, "", "", fmt.Errorf("Usage: Cond <breakpoint> [-h hitcond] [condition]")
+	}
+	id, err = strconv.Atoi(arg)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("Expected a breakpoint number, but found \"%v\": %w", arg, err)
+	}
+	if arg, after := firstArg(rest); arg == "-h" {
+		hitCond, rest = firstArg(after)
+		if hitCond == "" {
+			return 0, "", "", fmt.Errorf("-h needs an argument.")
+		}
+	}
+	return id, hitCond, strings.TrimSpace(rest), nil
+}
+
+// Args returns the options as arguments for parseBreakOpts.
+func (o BreakOpts) Args() []string {
+	var args []string
+	if o.Cond != "" {
+		args = append(args, "-c", o.Cond)
+	}
+	if o.HitCond != "" {
+		args = append(args, "-h", o.HitCond)
+	}
+	if o.Trace {
+		args = append(args, "-trace")
+	}
+	if o.Log != "" {
+		args = append(args, "-log", o.Log)
+	}
+	return args
+}
+
+// Apply sets the options on bp. A logpoint is a tracepoint that has dlv evaluate the expressions
+// in its message each time it is hit. The message itself is formatted when the hit is reported.
+func (o BreakOpts) Apply(bp *api.Breakpoint) {
+	bp.Cond = o.Cond
+	bp.HitCond = o.HitCond
+	bp.Tracepoint = o.Trace || o.Log != ""
+	bp.Variables = nil
+	bp.LoadArgs = nil
+	if o.Log != "" {
+		bp.Variables = logExprs(o.Log)
+	} else if o.Trace {
+		args := fileLoad
+		bp.LoadArgs = &args
+	}
+}
+
+// logExprs returns the expressions in a log message, in order.
+func logExprs(msg string) []string {
+	var exprs []string
+	forLogParts(msg, func(text string, expr bool) {
+		if expr {
+			exprs = append(exprs, text)
+		}
+	})
+	return exprs
+}
+
+// formatLog formats a log message, replacing its expressions with vars, the values dlv found for
+// them.
+func formatLog(msg string, vars []api.Variable) string {
+	var b strings.Builder
+	i := 0
+	forLogParts(msg, func(text string, expr bool) {
+		if !expr {
+			b.WriteString(text)
+			return
+		}
+		if i < len(vars) {
+			v := vars[i]
+			if v.Unreadable != "" {
+				fmt.Fprintf(&b, "<%s>", v.Unreadable)
+			} else {
+				b.WriteString(v.SinglelineString())
+			}
+		} else {
+			b.WriteString("<?>")
+		}
+		i++
+	})
+	return b.String()
+}
+
+// forLogParts calls fn with each piece of a log message: the literal text, and the expressions
+// between braces. "{{" and "}}" stand for literal braces.
+func forLogParts(msg string, fn func(text string, expr bool)) {
+	var lit strings.Builder
+	for i := 0; i < len(msg); i++ {
+		switch {
+		case strings.HasPrefix(msg[i:], "{{"), strings.HasPrefix(msg[i:], "}}"):
+			lit.WriteByte(msg[i])
+			i++
+		case msg[i] == '{':
+			end := strings.IndexByte(msg[i:], '}')
+			if end < 0 {
+				lit.WriteString(msg[i:])
+				i = len(msg)
+				continue
+			}
+			if lit.Len() > 0 {
+				fn(lit.String(), false)
+				lit.Reset()
+			}
+			fn(strings.TrimSpace(msg[i+1:i+end]), true)
+			i += end
+		default:
+			lit.WriteByte(msg[i])
+		}
+	}
+	if lit.Len() > 0 {
+		fn(lit.String(), false)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestParseBreakOpts(t *testing.T) {
+	for _, tt := range []struct {
+		in   []string
+		opts BreakOpts
+		rest []string
+		err  bool
+	}{
+		{
+			in:   []string{"12"},
+			rest: []string{"12"},
+		},
+		{
+			in:   []string{"-c", "x > 1", "-h", "% 2", "12"},
+			opts: BreakOpts{Cond: "x > 1", HitCond: "% 2"},
+			rest: []string{"12"},
+		},
+		{
+			in:   []string{"-trace"},
+			opts: BreakOpts{Trace: true},
+		},
+		{
+			in:   []string{"-log", "x is {x}", "-c", "ok"},
+			opts: BreakOpts{Log: "x is {x}", Cond: "ok"},
+		},
+		{
+			in:  []string{"-c"},
+			err: true,
+		},
+	} {
+		t.Run(joinArgs(tt.in), func(t *testing.T) {
+			opts, rest, err := parseBreakOpts(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Expected an error, but got %+v", opts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts != tt.opts || len(rest) != len(tt.rest) || (len(rest) > 0 && !reflect.DeepEqual(rest, tt.rest)) {
+				t.Fatalf("Expected %+v %q, but got %+v %q", tt.opts, tt.rest, opts, rest)
+			}
+			// Args gives back the same options.
+			again, _, err := parseBreakOpts(opts.Args())
+			if err != nil || again != opts {
+				t.Fatalf("Expected %+v from %q, but got %+v, %v", opts, opts.Args(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseCond(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		id      int
+		hitCond string
+		cond    string
+		err     bool
+	}{
+		{in: " 1", id: 1},
+		{in: " 1 x > 1", id: 1, cond: "x > 1"},
+		{in: " 1 c == 'a'", id: 1, cond: "c == 'a'"},
+		{in: ` 2 s == "a  b"`, id: 2, cond: `s == "a  b"`},
+		{in: " 2 -h '> 10'", id: 2, hitCond: "> 10"},
+		{in: " 2 -h %2 c != '\\''", id: 2, hitCond: "%2", cond: "c != '\\''"},
+		{in: " 3 -h", err: true},
+		{in: " x", err: true},
+		{in: "", err: true},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			id, hitCond, cond, err := parseCond(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Expected an error, but got %d %q %q", id, hitCond, cond)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tt.id || hitCond != tt.hitCond || cond != tt.cond {
+				t.Fatalf("Expected %d %q %q, but got %d %q %q", tt.id, tt.hitCond, tt.cond, id, hitCond, cond)
+			}
+		})
+	}
+}
+
+func TestForLogParts(t *testing.T) {
+	type part struct {
+		text string
+		expr bool
+	}
+	for _, tt := range []struct {
+		msg   string
+		parts []part
+	}{
+		{
+			msg:   "plain",
+			parts: []part{{"plain", false}},
+		},
+		{
+			msg:   "x={x} y={ p.y }",
+			parts: []part{{"x=", false}, {"x", true}, {" y=", false}, {"p.y", true}},
+		},
+		{
+			msg:   "{{literal}} {m[k]}",
+			parts: []part{{"{literal} ", false}, {"m[k]", true}},
+		},
+		{
+			msg:   "open {x",
+			parts: []part{{"open {x", false}},
+		},
+	} {
+		t.Run(tt.msg, func(t *testing.T) {
+			var parts []part
+			forLogParts(tt.msg, func(text string, expr bool) {
+				parts = append(parts, part{text, expr})
+			})
+			if !reflect.DeepEqual(parts, tt.parts) {
+				t.Fatalf("Expected %+v, but got %+v", tt.parts, parts)
+			}
+		})
+	}
+}
+
+func TestFormatLog(t *testing.T) {
+	vars := []api.Variable{
+		{Name: "x", Kind: reflect.Int, Value: "1"},
+		{Name: "y", Unreadable: "gone"},
+	}
+	for _, tt := range []struct {
+		msg  string
+		vars []api.Variable
+		out  string
+	}{
+		{
+			msg:  "x={x} y={y}",
+			vars: vars,
+			out:  "x=1 y=<gone>",
+		},
+		{
+			msg:  "x={x} z={z}",
+			vars: vars[:1],
+			out:  "x=1 z=<?>",
+		},
+		{
+			msg: "{{x}}",
+			out: "{x}",
+		},
+	} {
+		t.Run(tt.msg, func(t *testing.T) {
+			if out := formatLog(tt.msg, tt.vars); out != tt.out {
+				t.Fatalf("Expected %s, but got %s", tt.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpc2"
+)
+
+// cursorBreakpoint names the temporary breakpoint RunToCursor stops at.
+const cursorBreakpoint = "RunToCursor"
+
+// SavedBreakpoint is a breakpoint as it is saved between sessions.
+type SavedBreakpoint struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Text     string `json:"text"` // The line's text when the breakpoint was set, to find it again after edits.
+	Cond     string `json:"cond,omitempty"`
+	HitCond  string `json:"hitCond,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	Trace    bool   `json:"trace,omitempty"`
+	Log      string `json:"log,omitempty"`
+}
+
+// key identifies the saved breakpoint by its location.
+func (sb SavedBreakpoint) key() string {
+	return fmt.Sprintf("%s:%d", sb.File, sb.Line)
+}
+
+// Opts returns the saved breakpoint's options.
+func (sb SavedBreakpoint) Opts() BreakOpts {
+	return BreakOpts{Cond: sb.Cond, HitCond: sb.HitCond, Trace: sb.Trace, Log: sb.Log}
+}
+
+// Breakpoints keeps the breakpoints of a session saved for the session's module, in a file under
+// the user's config directory, so the module's next session starts with them.
+//
+// Breakpoints are found again after edits by the text of their line: if the line a breakpoint was
+// saved at no longer holds the same text, the breakpoint moves to the nearest line that does.
+//
+// Several sessions may debug the same module at once, so a session saves only what it changed
+// since it last saved, leaving the breakpoints other sessions saved alone.
+type Breakpoints struct {
+	root    string
+	c       *rpc2.RPCClient
+	saved   map[int]SavedBreakpoint    // By dlv's breakpoint ID.
+	lost    []SavedBreakpoint          // Saved breakpoints that could not be set. They stay saved until forgotten.
+	written map[string]SavedBreakpoint // What the session last saved, by key.
+}
+
+// NewBreakpoints returns the Breakpoints for the module at root, set through c.
+func NewBreakpoints(root string, c *rpc2.RPCClient) *Breakpoints {
+	return &Breakpoints{
+		root:    root,
+		c:       c,
+		saved:   make(map[int]SavedBreakpoint),
+		written: make(map[string]SavedBreakpoint),
+	}
+}
+
+// Create sets a breakpoint at file:line in dlv and saves it.
+func (b *Breakpoints) Create(file string, line int, o BreakOpts) (*api.Breakpoint, error) {
+	bp := &api.Breakpoint{File: file, Line: line}
+	o.Apply(bp)
+	bp, err := b.c.CreateBreakpoint(bp)
+	if err != nil {
+		return nil, err
+	}
+	b.saved[bp.ID] = saveBreakpoint(bp, lineText(bp.File, bp.Line), o.Log)
+	b.dropLost(bp.File, bp.Line)
+	err = b.Save()
+	if err != nil {
+		return nil, fmt.Errorf("Breakpoint %d was set, but not saved: %w", bp.ID, err)
+	}
+	return bp, nil
+}
+
+// Amend changes the condition and hit condition of the breakpoint with the given ID. Empty
+// conditions are removed.
+func (b *Breakpoints) Amend(id int, cond, hitCond string) (*api.Breakpoint, error) {
+	bp, err := b.c.GetBreakpoint(id)
+	if err != nil {
+		return nil, err
+	}
+	bp.Cond = cond
+	bp.HitCond = hitCond
+	err = b.c.AmendBreakpoint(bp)
+	if err != nil {
+		return nil, err
+	}
+	err = b.Save()
+	if err != nil {
+		return nil, fmt.Errorf("Breakpoint %d was changed, but not saved: %w", bp.ID, err)
+	}
+	return bp, nil
+}
+
+// Log returns the log message of the breakpoint with the given ID, if it is a logpoint.
+func (b *Breakpoints) Log(id int) string {
+	return b.saved[id].Log
+}
+
+// Clear clears the breakpoint with the given ID and forgets it.
+func (b *Breakpoints) Clear(id int) (*api.Breakpoint, error) {
+	bp, err := b.c.ClearBreakpoint(id)
+	if err != nil {
+		return nil, err
+	}
+	delete(b.saved, id)
+	b.dropLost(bp.File, bp.Line)
+	err = b.Save()
+	if err != nil {
+		return nil, fmt.Errorf("Breakpoint %d was cleared, but is still saved: %w", bp.ID, err)
+	}
+	return bp, nil
+}
+
+// Lost returns the saved breakpoints that could not be set.
+func (b *Breakpoints) Lost() []SavedBreakpoint {
+	return b.lost
+}
+
+// Forget forgets the saved breakpoint at file:line that could not be set, and reports whether
+// there was one.
+func (b *Breakpoints) Forget(file string, line int) (bool, error) {
+	if !b.dropLost(file, line) {
+		return false, nil
+	}
+	err := b.Save()
+	if err != nil {
+		return true, fmt.Errorf("Breakpoint at %s:%d was forgotten, but is still saved: %w", file, line, err)
+	}
+	return true, nil
+}
+
+// dropLost removes the lost breakpoint at file:line, and reports whether there was one.
+func (b *Breakpoints) dropLost(file string, line int) bool {
+	key := SavedBreakpoint{File: file, Line: line}.key()
+	for i, sb := range b.lost {
+		if sb.key() == key {
+			b.lost = append(b.lost[:i:i], b.lost[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Restore sets the breakpoints saved for the module, reporting each one to out.
+func (b *Breakpoints) Restore(out io.Writer) error {
+	sbs, err := loadBreakpoints(b.root)
+	if err != nil {
+		return err
+	}
+	b.written = keyBreakpoints(sbs)
+	for _, sb := range sbs {
+		b.restore(out, sb)
+	}
+	return b.Save()
+}
+
+// Restarted puts the breakpoints back where they belong after the target has been restarted.
+// dlv sets them again by line number, which may now be the wrong line, and discards those it
+// can't set.
+func (b *Breakpoints) Restarted(out io.Writer, discarded []api.DiscardedBreakpoint) error {
+	for _, d := range discarded {
+		if sb, ok := b.saved[d.Breakpoint.ID]; ok {
+			delete(b.saved, d.Breakpoint.ID)
+			b.restore(out, sb)
+		}
+	}
+	bps, err := b.c.ListBreakpoints(false)
+	if err != nil {
+		return err
+	}
+	for _, bp := range bps {
+		sb, ok := b.saved[bp.ID]
+		if !ok || sb.Text == "" || lineText(bp.File, bp.Line) == sb.Text {
+			continue
+		}
+		line, ok := findLine(bp.File, bp.Line, sb.Text)
+		if !ok || line == bp.Line {
+			continue
+		}
+		_, err := b.c.ClearBreakpoint(bp.ID)
+		if err != nil {
+			fmt.Fprintf(out, "Failed to move breakpoint %d: %v\n", bp.ID, err)
+			continue
+		}
+		delete(b.saved, bp.ID)
+		b.restore(out, sb)
+	}
+	return b.Save()
+}
+
+// restore sets the saved breakpoint sb, at the line holding its text.
+func (b *Breakpoints) restore(out io.Writer, sb SavedBreakpoint) {
+	line := sb.Line
+	if sb.Text != "" {
+		if l, ok := findLine(sb.File, sb.Line, sb.Text); ok {
+			line = l
+		}
+	}
+	bp := &api.Breakpoint{File: sb.File, Line: line, Disabled: sb.Disabled}
+	sb.Opts().Apply(bp)
+	bp, err := b.c.CreateBreakpoint(bp)
+	if err != nil {
+		if lineGone(sb) {
+			fmt.Fprintf(out, "Dropped breakpoint at %s:%d: its line no longer exists\n", sb.File, sb.Line)
+			return
+		}
+		fmt.Fprintf(out, "Failed to restore breakpoint at %s:%d: %v\n", sb.File, sb.Line, err)
+		b.lost = append(b.lost, sb)
+		return
+	}
+	if line != sb.Line {
+		fmt.Fprintf(out, "Breakpoint %d moved from %s:%d to %s:%d\n", bp.ID, sb.File, sb.Line, bp.File, bp.Line)
+	} else {
+		fmt.Fprintf(out, "Breakpoint %d restored at %s:%d\n", bp.ID, bp.File, bp.Line)
+	}
+	text := sb.Text
+	if text == "" {
+		text = lineText(bp.File, bp.Line)
+	}
+	b.saved[bp.ID] = saveBreakpoint(bp, text, sb.Log)
+}
+
+// Save saves the session's breakpoints, as dlv has them now.
+func (b *Breakpoints) Save() error {
+	bps, err := b.c.ListBreakpoints(false)
+	if err != nil {
+		return err
+	}
+	saved := make(map[int]SavedBreakpoint)
+	sbs := append([]SavedBreakpoint(nil), b.lost...)
+	for _, bp := range bps {
+		if bp.ID <= 0 || bp.Name == cursorBreakpoint || bp.WatchExpr != "" {
+			// Breakpoints dlv sets itself, such as the one for unrecovered panics, the
+			// temporary one set by RunToCursor, and watchpoints, which only last as long as
+			// the variable they watch.
+			continue
+		}
+		prev := b.saved[bp.ID]
+		text := prev.Text
+		if text == "" {
+			text = lineText(bp.File, bp.Line)
+		}
+		saved[bp.ID] = saveBreakpoint(bp, text, prev.Log)
+		sbs = append(sbs, saved[bp.ID])
+	}
+	b.saved = saved
+	return b.merge(sbs)
+}
+
+// merge saves sbs, the session's breakpoints, into the module's file. The file is changed only
+// where sbs differs from what the session last saved: breakpoints the session set or changed are
+// written, and those it cleared are removed. The rest of the file, holding what other sessions
+// saved, is kept.
+func (b *Breakpoints) merge(sbs []SavedBreakpoint) error {
+	unlock, err := lockBreakpoints(b.root)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cur, err := loadBreakpoints(b.root)
+	if err != nil {
+		return err
+	}
+	merged := keyBreakpoints(cur)
+	now := keyBreakpoints(sbs)
+	for k := range b.written {
+		if _, ok := now[k]; !ok {
+			delete(merged, k)
+		}
+	}
+	for k, sb := range now {
+		if prev, ok := b.written[k]; !ok || prev != sb {
+			merged[k] = sb
+		}
+	}
+	b.written = now
+
+	out := make([]SavedBreakpoint, 0, len(merged))
+	for _, sb := range merged {
+		out = append(out, sb)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].File != out[j].File {
+			return out[i].File < out[j].File
+		}
+		return out[i].Line < out[j].Line
+	})
+	return saveBreakpoints(b.root, out)
+}
+
+// keyBreakpoints returns sbs by key.
+func keyBreakpoints(sbs []SavedBreakpoint) map[string]SavedBreakpoint {
+	m := make(map[string]SavedBreakpoint, len(sbs))
+	for _, sb := range sbs {
+		m[sb.key()] = sb
+	}
+	return m
+}
+
+func saveBreakpoint(bp *api.Breakpoint, text, log string) SavedBreakpoint {
+	return SavedBreakpoint{
+		File:     bp.File,
+		Line:     bp.Line,
+		Text:     text,
+		Cond:     bp.Cond,
+		HitCond:  bp.HitCond,
+		Disabled: bp.Disabled,
+		Trace:    bp.Tracepoint && log == "",
+		Log:      log,
+	}
+}
+
+// breakpointsPath returns the file the breakpoints of the module at root are saved in.
+func breakpointsPath(root string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "acme-dlv", "breakpoints", url.PathEscape(root)+".json"), nil
+}
+
+// lockBreakpoints locks the file the breakpoints of the module at root are saved in against other
+// sessions saving to it, and returns the function that unlocks it.
+func lockBreakpoints(root string) (func(), error) {
+	p, err := breakpointsPath(root)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(p+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to lock %s: %w", p, err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// loadBreakpoints returns the breakpoints saved for the module at root.
+func loadBreakpoints(root string) ([]SavedBreakpoint, error) {
+	p, err := breakpointsPath(root)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sbs []SavedBreakpoint
+	err = json.Unmarshal(bs, &sbs)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", p, err)
+	}
+	return sbs, nil
+}
+
+// saveBreakpoints replaces the breakpoints saved for the module at root with sbs.
+func saveBreakpoints(root string, sbs []SavedBreakpoint) error {
+	p, err := breakpointsPath(root)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	if sbs == nil {
+		sbs = []SavedBreakpoint{}
+	}
+	bs, err := json.MarshalIndent(sbs, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(bs, '\n'))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// fileLines returns the lines of file, with surrounding white space removed.
+func fileLines(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		lines = append(lines, strings.TrimSpace(s.Text()))
+	}
+	return lines
+}
+
+// lineText returns the text of line in file, with surrounding white space removed.
+func lineText(file string, line int) string {
+	lines := fileLines(file)
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return lines[line-1]
+}
+
+// lineGone reports whether the line sb was saved at is gone: its file no longer exists, or no
+// longer has the line's text, or, if the text wasn't saved, has fewer lines.
+func lineGone(sb SavedBreakpoint) bool {
+	if _, err := os.Stat(sb.File); errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	if sb.Text != "" {
+		_, ok := findLine(sb.File, sb.Line, sb.Text)
+		return !ok
+	}
+	return sb.Line > len(fileLines(sb.File))
+}
+
+// findLine returns the line of file holding text that is nearest to line.
+func findLine(file string, line int, text string) (int, bool) {
+	lines := fileLines(file)
+	for d := 0; d < len(lines); d++ {
+		for _, l := range []int{line - d, line + d} {
+			if l >= 1 && l <= len(lines) && lines[l-1] == text {
+				return l, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBreakpointsMerge(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	const root = "/m"
+	a := NewBreakpoints(root, nil)
+	b := NewBreakpoints(root, nil)
+
+	x := SavedBreakpoint{File: "/m/x.go", Line: 1}
+	y := SavedBreakpoint{File: "/m/y.go", Line: 2}
+	z := SavedBreakpoint{File: "/m/z.go", Line: 3}
+
+	check := func(want ...SavedBreakpoint) {
+		t.Helper()
+		got, err := loadBreakpoints(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) == 0 && len(want) == 0 {
+			return
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Expected %+v, but got %+v", want, got)
+		}
+	}
+
+	// Both sessions start with x and y, as Restore would load them.
+	if err := a.merge([]SavedBreakpoint{x, y}); err != nil {
+		t.Fatal(err)
+	}
+	b.written = keyBreakpoints([]SavedBreakpoint{x, y})
+	check(x, y)
+
+	// b sets z. a's breakpoints stay.
+	if err := b.merge([]SavedBreakpoint{x, y, z}); err != nil {
+		t.Fatal(err)
+	}
+	check(x, y, z)
+
+	// a clears x, without knowing of z.
+	if err := a.merge([]SavedBreakpoint{y}); err != nil {
+		t.Fatal(err)
+	}
+	check(y, z)
+
+	// b saves again with x unchanged. a's clearing of it stands.
+	if err := b.merge([]SavedBreakpoint{x, y, z}); err != nil {
+		t.Fatal(err)
+	}
+	check(y, z)
+
+	// a adds a condition to y.
+	yc := y
+	yc.Cond = "i > 2"
+	if err := a.merge([]SavedBreakpoint{yc}); err != nil {
+		t.Fatal(err)
+	}
+	check(yc, z)
+
+	// b clears everything it has.
+	if err := b.merge(nil); err != nil {
+		t.Fatal(err)
+	}
+	check()
+}
+
+func TestLineGone(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "x.go")
+	if err := os.WriteFile(file, []byte("package x\n\nfunc f() {\n\tg()\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		sb   SavedBreakpoint
+		gone bool
+	}{
+		{name: "same line", sb: SavedBreakpoint{File: file, Line: 4, Text: "g()"}, gone: false},
+		{name: "moved line", sb: SavedBreakpoint{File: file, Line: 2, Text: "g()"}, gone: false},
+		{name: "text gone", sb: SavedBreakpoint{File: file, Line: 4, Text: "h()"}, gone: true},
+		{name: "no text", sb: SavedBreakpoint{File: file, Line: 5}, gone: false},
+		{name: "no text past end", sb: SavedBreakpoint{File: file, Line: 9}, gone: true},
+		{name: "file gone", sb: SavedBreakpoint{File: file + "x", Line: 1}, gone: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if gone := lineGone(tt.sb); gone != tt.gone {
+				t.Fatalf("Expected %v, but got %v", tt.gone, gone)
+			}
+		})
+	}
+}
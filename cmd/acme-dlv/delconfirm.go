@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/knusbaum/acmetools"
+)
+
+// delConfirm keeps the warning Del gives before it kills a running target. Del has to be given
+// again to go ahead, and anything else the user does in the window in between, or the target
+// stopping, takes the warning back. Output written to the window through its files is not the
+// user's doing, and leaves the warning standing.
+type delConfirm struct {
+	warned bool
+}
+
+// Event notes an event of the session's window.
+func (d *delConfirm) Event(e *acmetools.Event) {
+	if e.Origin != acmetools.EV_Keyboard && e.Origin != acmetools.EV_Mouse {
+		return
+	}
+	if !isDel(e) {
+		d.warned = false
+	}
+}
+
+// Del reports whether Del should go ahead, given whether the target is running. If not, the
+// caller warns, and the next Del goes ahead.
+func (d *delConfirm) Del(running bool) bool {
+	if d.warned || !running {
+		return true
+	}
+	d.warned = true
+	return false
+}
+
+// Reset takes the warning back.
+func (d *delConfirm) Reset() {
+	d.warned = false
+}
+
+// isDel reports whether e runs Del.
+func isDel(e *acmetools.Event) bool {
+	return (e.Type == acmetools.ET_BodyBtn2 || e.Type == acmetools.ET_TagBtn2) && strings.TrimSpace(e.S) == "Del"
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/knusbaum/acmetools"
+)
+
+func TestDelConfirm(t *testing.T) {
+	del := &acmetools.Event{Origin: acmetools.EV_Mouse, Type: acmetools.ET_TagBtn2, S: "Del"}
+	output := &acmetools.Event{Origin: acmetools.EV_File, Type: acmetools.ET_BodyInsert, S: "The target is running.\n"}
+	typed := &acmetools.Event{Origin: acmetools.EV_Keyboard, Type: acmetools.ET_BodyInsert, S: "x"}
+	next := &acmetools.Event{Origin: acmetools.EV_Mouse, Type: acmetools.ET_TagBtn2, S: "Next"}
+
+	for _, tt := range []struct {
+		name    string
+		events  []*acmetools.Event // Before the second Del.
+		stopped bool               // Whether the target stops before the second Del.
+		kill    bool               // Whether the second Del goes ahead.
+	}{
+		{name: "again", kill: true},
+		{name: "output between", events: []*acmetools.Event{output, output}, kill: true},
+		{name: "typing between", events: []*acmetools.Event{output, typed}, kill: false},
+		{name: "command between", events: []*acmetools.Event{next, output}, kill: false},
+		{name: "stop between", events: []*acmetools.Event{output}, stopped: true, kill: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var d delConfirm
+			d.Event(del)
+			if d.Del(true) {
+				t.Fatalf("Expected the first Del to warn, but it went ahead")
+			}
+			// The warning itself comes back as output.
+			d.Event(output)
+			for _, e := range tt.events {
+				d.Event(e)
+			}
+			if tt.stopped {
+				d.Reset()
+			}
+			d.Event(del)
+			if kill := d.Del(true); kill != tt.kill {
+				t.Fatalf("Expected %v, but got %v", tt.kill, kill)
+			}
+		})
+	}
+
+	// A Del with the target not running goes ahead at once.
+	var d delConfirm
+	if !d.Del(false) {
+		t.Fatalf("Expected Del to go ahead with the target not running")
+	}
+}
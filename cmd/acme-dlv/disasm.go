@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// formatDisasm lists the instructions of a function, one per line:
+//
+//	mark address instruction
+//
+// The instruction at pc is marked with "=>", and instructions with a breakpoint with '*'. Each
+// run of instructions for one source line is headed by the line's file:line and text, and CALL
+// instructions are followed by the address they call, so clicking it disassembles the callee.
+func formatDisasm(insts api.AsmInstructions, pc uint64) string {
+	var b bytes.Buffer
+	if len(insts) > 0 {
+		fmt.Fprintf(&b, "TEXT %s\n", insts[0].Loc.Function.Name())
+	}
+	file, line := "", 0
+	for _, inst := range insts {
+		if inst.Loc.File != file || inst.Loc.Line != line {
+			file, line = inst.Loc.File, inst.Loc.Line
+			fmt.Fprintf(&b, "\n%s:%d\t%s\n", file, line, lineText(file, line))
+		}
+		mark := "  "
+		switch {
+		case inst.Loc.PC == pc:
+			mark = "=>"
+		case inst.Breakpoint:
+			mark = " *"
+		}
+		fmt.Fprintf(&b, "%s\t%#x\t%s", mark, inst.Loc.PC, inst.Text)
+		if inst.DestLoc != nil && inst.DestLoc.PC != 0 {
+			fmt.Fprintf(&b, "\t%#x", inst.DestLoc.PC)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatRegs lists the registers of frame n of a goroutine, one per line.
+func formatRegs(goroutine int64, frame int, regs api.Registers) string {
+	return fmt.Sprintf("Goroutine %d frame %d\n\n%s", goroutine, frame, regs.String())
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go/parser"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpc2"
+)
+
+// maxExamine is the most memory dlv reads at once.
+const maxExamine = 1000
+
+// The formats of Examine.
+const (
+	examineHex     = "x" // hex bytes and ASCII, 16 bytes a line
+	examineWords   = "w" // 8 byte words in hex, 4 a line
+	examinePointer = "p" // 8 byte pointers, one a line, with the function each points into
+)
+
+// parseExamine parses the arguments of Examine:
+//
+//	Examine <addr|expr> [count] [x|w|p]
+//
+// count is the number of bytes for the x format, and the number of words or pointers otherwise.
+// Trailing words are only taken as the count and format if what comes before them is an
+// expression, so "a - 1" is an expression rather than "a -" with a count of 1.
+func parseExamine(arg string) (expr string, count int, format string, err error) {
+	expr, format = strings.TrimSpace(arg), examineHex
+	rest, word := lastWord(expr)
+	switch word {
+	case examineHex, examineWords, examinePointer:
+		if isExpr(rest) || isExpr(withoutCount(rest)) {
+			expr, format = rest, word
+		}
+	}
+	rest, word = lastWord(expr)
+	if n, err := strconv.Atoi(word); err == nil && isExpr(rest) {
+		expr, count = rest, n
+	}
+	size := 1
+	if format != examineHex {
+		size = 8
+	}
+	if count == 0 {
+		count = 64 / size
+	}
+	if count < 0 || count*size > maxExamine {
+		return "", 0, "", fmt.Errorf("Examine can read between 1 and %d bytes.", maxExamine)
+	}
+	if expr == "" {
+		return "", 0, "", fmt.Errorf("Usage: Examine <addr|expr> [count] [x|w|p]")
+	}
+	return expr, count * size, format, nil
+}
+
+// withoutCount returns s without a trailing count.
+func withoutCount(s string) string {
+	rest, word := lastWord(s)
+	if _, err := strconv.Atoi(word); err != nil {
+		return s
+	}
+	return rest
+}
+
+// isExpr reports whether s parses as an expression.
+func isExpr(s string) bool {
+	if strings.TrimSpace(s) == "" {
+		return false
+	}
+	_, err := parser.ParseExpr(s)
+	return err == nil
+}
+
+// lastWord splits the last white space separated word from s.
+func lastWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := strings.LastIndexAny(s, " \t")
+	if i < 0 {
+		return "", s
+	}
+	return strings.TrimSpace(s[:i]), s[i+1:]
+}
+
+// examineAddress returns the address expr stands for. It is either a number, or an expression
+// whose value is a pointer or an integer, or else whose own address is used.
+func examineAddress(c *rpc2.RPCClient, scope api.EvalScope, expr string) (uint64, error) {
+	if addr, err := strconv.ParseUint(expr, 0, 64); err == nil {
+		return addr, nil
+	}
+	v, err := c.EvalVariable(scope, expr, api.LoadConfig{FollowPointers: false})
+	if err != nil {
+		return 0, err
+	}
+	switch v.Kind {
+	case reflect.Ptr, reflect.UnsafePointer:
+		if len(v.Children) < 1 {
+			return 0, fmt.Errorf("Failed to find what %s points to.", expr)
+		}
+		return v.Children[0].Addr, nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		addr, err := strconv.ParseUint(v.Value, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s is not an address: %w", expr, err)
+		}
+		return addr, nil
+	}
+	if v.Addr == 0 {
+		return 0, fmt.Errorf("%s has no address.", expr)
+	}
+	return v.Addr, nil
+}
+
+// formatMemory formats mem, read at addr, in format. symbol names the function an address is in,
+// or returns "".
+func formatMemory(addr uint64, mem []byte, format string, symbol func(uint64) string) string {
+	var b bytes.Buffer
+	switch format {
+	case examineWords, examinePointer:
+		perLine := 4
+		if format == examinePointer {
+			perLine = 1
+		}
+		for i := 0; i+8 <= len(mem); i += 8 {
+			if (i/8)%perLine == 0 {
+				fmt.Fprintf(&b, "%#x:", addr+uint64(i))
+			}
+			w := binary.LittleEndian.Uint64(mem[i:])
+			fmt.Fprintf(&b, "\t%#016x", w)
+			if format == examinePointer {
+				if w != 0 {
+					if sym := symbol(w); sym != "" {
+						fmt.Fprintf(&b, "\t%s", sym)
+					}
+				}
+			}
+			if (i/8)%perLine == perLine-1 || i+16 > len(mem) {
+				b.WriteString("\n")
+			}
+		}
+	default:
+		for i := 0; i < len(mem); i += 16 {
+			line := mem[i:]
+			if len(line) > 16 {
+				line = line[:16]
+			}
+			fmt.Fprintf(&b, "%#x:", addr+uint64(i))
+			for j := 0; j < 16; j++ {
+				if j%8 == 0 {
+					b.WriteString(" ")
+				}
+				if j < len(line) {
+					fmt.Fprintf(&b, " %02x", line[j])
+				} else {
+					b.WriteString("   ")
+				}
+			}
+			b.WriteString("  |")
+			for _, c := range line {
+				if c < 0x20 || c > 0x7e {
+					c = '.'
+				}
+				b.WriteByte(c)
+			}
+			b.WriteString("|\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestParseExamine(t *testing.T) {
+	for _, tt := range []struct {
+		in     string
+		expr   string
+		n      int
+		format string
+		err    bool
+	}{
+		{in: "p", expr: "p", n: 64, format: "x"},
+		{in: "x", expr: "x", n: 64, format: "x"},
+		{in: "&x 32", expr: "&x", n: 32, format: "x"},
+		{in: "x 16 w", expr: "x", n: 128, format: "w"},
+		{in: "buf w", expr: "buf", n: 64, format: "w"},
+		{in: "p + 8 4 p", expr: "p + 8", n: 32, format: "p"},
+		{in: "a - 1", expr: "a - 1", n: 64, format: "x"},
+		{in: "a - x", expr: "a - x", n: 64, format: "x"},
+		{in: "a - 1 8", expr: "a - 1", n: 8, format: "x"},
+		{in: "0xc000123000 16", expr: "0xc000123000", n: 16, format: "x"},
+		{in: "0xc000 3000", err: true},
+		{in: "0xc000 126 w", err: true},
+		{in: "", err: true},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			expr, n, format, err := parseExamine(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Expected an error, but got (%q, %d, %q)", expr, n, format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expr != tt.expr || n != tt.n || format != tt.format {
+				t.Fatalf("Expected (%q, %d, %q), but got (%q, %d, %q)", tt.expr, tt.n, tt.format, expr, n, format)
+			}
+		})
+	}
+}
+
+func TestFormatMemory(t *testing.T) {
+	mem := []byte("hello, world! this is memory.\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a")
+	symbol := func(a uint64) string {
+		if a == 0x77202c6f6c6c6568 {
+			return "main.f"
+		}
+		return ""
+	}
+	for _, tt := range []struct {
+		format string
+		mem    []byte
+		out    string
+	}{
+		{
+			format: "x",
+			mem:    mem,
+			out: "" +
+				"0x1000:  68 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 20 74 68  |hello, world! th|\n" +
+				"0x1010:  69 73 20 69 73 20 6d 65  6d 6f 72 79 2e 00 01 02  |is is memory....|\n" +
+				"0x1020:  03 04 05 06 07 08 09 0a                           |........|\n",
+		},
+		{
+			format: "w",
+			mem:    mem[:40],
+			out: "" +
+				"0x1000:\t0x77202c6f6c6c6568\t0x68742021646c726f\t0x656d207369207369\t0x0201002e79726f6d\n" +
+				"0x1020:\t0x0a09080706050403\n",
+		},
+		{
+			format: "p",
+			mem:    mem[:16],
+			out: "" +
+				"0x1000:\t0x77202c6f6c6c6568\tmain.f\n" +
+				"0x1008:\t0x68742021646c726f\n",
+		},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			if out := formatMemory(0x1000, tt.mem, tt.format, symbol); out != tt.out {
+				t.Fatalf("Expected\n%s\nbut got\n%s", tt.out, out)
+			}
+		})
+	}
+}
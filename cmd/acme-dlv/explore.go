@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpc2"
+)
+
+// explorePage is how many elements of an array, slice, map or string the explorer shows at once.
+const explorePage = 20
+
+// exploreLoad loads a shallow view of a variable: its direct children, each with enough of its
+// own children to be summarized on one line.
+var exploreLoad = api.LoadConfig{
+	FollowPointers:     true,
+	MaxVariableRecurse: 1,
+	MaxStringLen:       200,
+	MaxArrayValues:     explorePage,
+	MaxStructFields:    -1,
+}
+
+// explorer is the state of a session's variable explorer window, which shows one variable and
+// its children at a time. Each child is numbered, and Expand N explores child N. Large arrays,
+// slices, maps and strings are shown a page at a time, and More shows the next page. Back
+// returns to the variable explored before.
+type explorer struct {
+	expr     string   // The expression being explored.
+	children []string // The expression for each numbered child, or "" if it can't be explored.
+	more     string   // The expression for the next page, if there is one.
+	history  []string
+}
+
+// Explore evaluates expr in scope and returns the text of the explorer window showing it. If
+// push is set, the expression explored before is remembered for Back.
+func (x *explorer) Explore(c *rpc2.RPCClient, scope api.EvalScope, expr string, push bool) (string, error) {
+	v, err := c.EvalVariable(scope, expr, exploreLoad)
+	if err != nil {
+		return "", err
+	}
+	if push && x.expr != "" && x.expr != expr {
+		x.history = append(x.history, x.expr)
+	}
+	x.expr = expr
+	x.children = nil
+	x.more = ""
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s (%s)", expr, v.Type)
+	if v.Len > 0 || v.Kind == reflect.Slice || v.Kind == reflect.Map {
+		fmt.Fprintf(&b, " len=%d", v.Len)
+	}
+	if v.Kind == reflect.Slice {
+		fmt.Fprintf(&b, " cap=%d", v.Cap)
+	}
+	if v.Unreadable != "" {
+		fmt.Fprintf(&b, "\n\nunreadable: %s\n", v.Unreadable)
+		return b.String(), nil
+	}
+	b.WriteString("\n\n")
+
+	child := func(name, path string, cv *api.Variable) {
+		x.children = append(x.children, path)
+		fmt.Fprintf(&b, "%d\t%s %s = %s\n", len(x.children), name, cv.Type, summary(cv))
+	}
+	p := parenthesize(expr)
+	loaded := int64(0)
+	switch v.Kind {
+	case reflect.Struct:
+		for i := range v.Children {
+			cv := &v.Children[i]
+			child(cv.Name, p+"."+cv.Name, cv)
+		}
+	case reflect.Array, reflect.Slice:
+		for i := range v.Children {
+			cv := &v.Children[i]
+			child(fmt.Sprintf("[%d]", i), fmt.Sprintf("%s[%d]", p, i), cv)
+		}
+		loaded = int64(len(v.Children))
+	case reflect.Map:
+		for i := 0; i+1 < len(v.Children); i += 2 {
+			k, cv := &v.Children[i], &v.Children[i+1]
+			path := ""
+			if key, ok := mapKey(k); ok {
+				path = fmt.Sprintf("%s[%s]", p, key)
+			}
+			child(fmt.Sprintf("[%s]", summary(k)), path, cv)
+		}
+		loaded = int64(len(v.Children) / 2)
+	case reflect.Ptr:
+		if len(v.Children) > 0 && v.Children[0].Addr != 0 {
+			child("*", "*"+p, &v.Children[0])
+		} else {
+			fmt.Fprintf(&b, "%s\n", summary(v))
+		}
+	case reflect.Interface:
+		if len(v.Children) > 0 {
+			cv := &v.Children[0]
+			path := ""
+			if cv.Type != "" {
+				path = fmt.Sprintf("%s.(%s)", p, cv.Type)
+			}
+			child("data", path, cv)
+		} else {
+			fmt.Fprintf(&b, "%s\n", summary(v))
+		}
+	case reflect.String:
+		fmt.Fprintf(&b, "%s\n", strconv.Quote(v.Value))
+		loaded = int64(len(v.Value))
+	default:
+		fmt.Fprintf(&b, "%s\n", summary(v))
+	}
+	if loaded > 0 && loaded < v.Len {
+		x.more = fmt.Sprintf("%s[%d:]", p, loaded)
+		fmt.Fprintf(&b, "\n%d more. More shows %s\n", v.Len-loaded, x.more)
+	}
+	return b.String(), nil
+}
+
+// Child returns the expression for child n, counting from 1.
+func (x *explorer) Child(n int) (string, error) {
+	if n < 1 || n > len(x.children) {
+		return "", fmt.Errorf("No child %d of %s.", n, x.expr)
+	}
+	if x.children[n-1] == "" {
+		return "", fmt.Errorf("Child %d of %s can't be explored.", n, x.expr)
+	}
+	return x.children[n-1], nil
+}
+
+// Back forgets and returns the expression explored before the current one.
+func (x *explorer) Back() (string, bool) {
+	if len(x.history) == 0 {
+		return "", false
+	}
+	expr := x.history[len(x.history)-1]
+	x.history = x.history[:len(x.history)-1]
+	return expr, true
+}
+
+// summary returns a one line description of v.
+func summary(v *api.Variable) string {
+	if v.Unreadable != "" {
+		return fmt.Sprintf("<%s>", v.Unreadable)
+	}
+	return v.SinglelineString()
+}
+
+var simpleExprRE = regexp.MustCompile(`^[\w.\[\]]+$`)
+
+// parenthesize returns expr in parentheses, unless it is simple enough to be used as the operand
+// of a selector or index expression as it is.
+func parenthesize(expr string) string {
+	if simpleExprRE.MatchString(expr) {
+		return expr
+	}
+	return "(" + expr + ")"
+}
+
+// mapKey returns an expression for the map key k, if it has a simple one.
+func mapKey(k *api.Variable) (string, bool) {
+	switch k.Kind {
+	case reflect.String:
+		if int64(len(k.Value)) < k.Len {
+			// The key wasn't loaded in full.
+			return "", false
+		}
+		return strconv.Quote(k.Value), true
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return k.Value, true
+	}
+	return "", false
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpc2"
+)
+
+// goroutineStatus names the values of api.Goroutine.Status.
+var goroutineStatus = map[uint64]string{
+	0: "idle",
+	1: "runnable",
+	2: "running",
+	3: "syscall",
+	4: "waiting",
+	6: "dead",
+	8: "preempted",
+}
+
+// listGoroutines lists the goroutines chosen by args, one per line:
+//
+//	id status file:line function start file:line function labels...
+//
+// The line of the goroutine cur is marked with '*'. The arguments are filters, all of which a
+// goroutine must pass:
+//
+//	-u          only user goroutines, not the runtime's
+//	-l k[=v]    only goroutines with the label k, or with k set to v
+//	-s regexp   only goroutines with a frame whose "function file:line" matches regexp
+func listGoroutines(c *rpc2.RPCClient, args []string, cur int64) (string, error) {
+	var filters []api.ListGoroutinesFilter
+	var stackRE *regexp.Regexp
+	for len(args) > 0 {
+		switch args[0] {
+		case "-u":
+			filters = append(filters, api.ListGoroutinesFilter{Kind: api.GoroutineUser})
+			args = args[1:]
+		case "-l", "-s":
+			if len(args) < 2 {
+				return "", fmt.Errorf("%s needs an argument.", args[0])
+			}
+			if args[0] == "-l" {
+				filters = append(filters, api.ListGoroutinesFilter{Kind: api.GoroutineLabel, Arg: args[1]})
+			} else {
+				re, err := regexp.Compile(args[1])
+				if err != nil {
+					return "", err
+				}
+				stackRE = re
+			}
+			args = args[2:]
+		default:
+			return "", fmt.Errorf("Unknown goroutine filter %s", args[0])
+		}
+	}
+
+	gs, _, _, _, err := c.ListGoroutinesWithFilter(0, 0, filters, nil)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	n := 0
+	for _, g := range gs {
+		if stackRE != nil {
+			match, err := stackMatches(c, g.ID, stackRE)
+			if err != nil {
+				return "", err
+			}
+			if !match {
+				continue
+			}
+		}
+		n++
+		mark := " "
+		if g.ID == cur {
+			mark = "*"
+		}
+		status, ok := goroutineStatus[g.Status]
+		if !ok {
+			status = fmt.Sprintf("status%d", g.Status)
+		}
+		loc, start := g.UserCurrentLoc, g.StartLoc
+		fmt.Fprintf(&b, "%s %d\t%s\t%s:%d %s\tstart %s:%d %s", mark, g.ID, status,
+			loc.File, loc.Line, loc.Function.Name(), start.File, start.Line, start.Function.Name())
+		keys := make([]string, 0, len(g.Labels))
+		for k := range g.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "\t%s=%s", k, g.Labels[k])
+		}
+		b.WriteString("\n")
+	}
+	return fmt.Sprintf("%d goroutines\n\n%s", n, b.String()), nil
+}
+
+// stackMatches reports whether any frame of goroutine id matches re.
+func stackMatches(c *rpc2.RPCClient, id int64, re *regexp.Regexp) (bool, error) {
+	frames, err := c.Stacktrace(id, 100, 0, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, fr := range frames {
+		if re.MatchString(fmt.Sprintf("%s %s:%d", fr.Function.Name(), fr.File, fr.Line)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/knusbaum/acmetools"
+)
+
+// DlvProcess is a headless dlv serving a debug session.
+type DlvProcess struct {
+	Cmd    *exec.Cmd    // The dlv process, or nil if the session connected to an existing dlv.
+	Addr   string       // The address of dlv's API server.
+	Exited <-chan error // Receives the result of waiting for Cmd once it exits.
+}
+
+// stopGrace is how long dlv is given to exit by itself once a session ends, before it is killed.
+const stopGrace = 5 * time.Second
+
+// Stop waits for dlv to exit, killing it if it hasn't within stopGrace, and reaps it. dlv runs in
+// a session of its own, and starts the target in a process group of its own, so both groups are
+// killed: dlv's, and target's if target is not 0.
+func (p *DlvProcess) Stop(target int) {
+	if p.Cmd == nil {
+		return
+	}
+	select {
+	case <-p.Exited:
+		return
+	case <-time.After(stopGrace):
+	}
+	syscall.Kill(-p.Cmd.Process.Pid, syscall.SIGKILL)
+	if target > 0 {
+		syscall.Kill(-target, syscall.SIGKILL)
+		syscall.Kill(target, syscall.SIGKILL)
+	}
+	<-p.Exited
+}
+
+var listeningRE = regexp.MustCompile(`API server listening at: (\S+)`)
+
+// LaunchDlv starts dlv for the session on term and waits, for at most *timeout, for its API
+// server to start listening. dlv listens on a port picked by the kernel, and the address is
+// taken from dlv's output. If dlv exits first, for instance because the program failed to build,
+// its output has already been written to term and the exit status is returned as an error.
+//
+// In ModeConnect no process is started, and the address is the one given to New. testOut is
+// passed to cfg.DlvArgs.
+func LaunchDlv(cfg SessionConfig, term *acmetools.Term, testOut string) (*DlvProcess, error) {
+	if cfg.Mode == ModeConnect {
+		return &DlvProcess{Addr: cfg.Args[0]}, nil
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	c := exec.Command("dlv", cfg.DlvArgs("127.0.0.1:0", testOut)...)
+	c.Dir = cfg.Dir
+	c.Stdout = pw
+	c.Stderr = pw
+	fmt.Printf("Starting: %v\n", c)
+	err = term.Start(c)
+	pw.Close()
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+
+	addr := make(chan string, 1)
+	go func() {
+		defer pr.Close()
+		watchDlvOutput(pr, term, addr)
+	}()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- c.Wait()
+	}()
+
+	select {
+	case a := <-addr:
+		return &DlvProcess{Cmd: c, Addr: a, Exited: exited}, nil
+	case err := <-exited:
+		if err == nil {
+			err = fmt.Errorf("dlv exited before its API server started")
+		}
+		return nil, fmt.Errorf("dlv failed to start: %w", err)
+	case <-time.After(*timeout):
+		// dlv was started in a session of its own, so its pid is its process group, and the build
+		// it may be running is killed with it.
+		syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+		<-exited
+		return nil, fmt.Errorf("dlv did not start within %v", *timeout)
+	}
+}
+
+// watchDlvOutput copies dlv's output from r to w as it arrives. Until the line announcing the
+// address of the API server is seen, the output is also scanned a line at a time for it, and the
+// address is sent on addr.
+func watchDlvOutput(r io.Reader, w io.Writer, addr chan<- string) {
+	var line []byte
+	bs := make([]byte, 8192)
+	for {
+		n, err := r.Read(bs)
+		if n > 0 {
+			w.Write(bs[:n])
+			line = append(line, bs[:n]...)
+			for {
+				i := bytes.IndexByte(line, '\n')
+				if i < 0 {
+					break
+				}
+				if m := listeningRE.FindSubmatch(line[:i]); m != nil {
+					addr <- string(m[1])
+					io.Copy(w, r)
+					return
+				}
+				line = line[i+1:]
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -2,13 +2,14 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
-	"os/exec"
 	"os/user"
 	"path"
 	"strconv"
@@ -28,19 +29,24 @@ import (
 
 type AcmeSrv struct {
 	log  chan string
-	cmds chan string
+	cmds chan *Request
+
+	fs       *fs.FS
+	user     string
+	group    string
+	sessions *fs.StaticDir
 }
 
-func Serve() *AcmeSrv {
-	user := "kjn"
-	group := "kjn"
+// Serve posts the acme-dlv file system in the namespace as name, with its files owned by user
+// and group.
+func Serve(name, user, group string) *AcmeSrv {
 
 	logChan := make(chan string, 100)
-	cmds := make(chan string, 100)
+	cmds := make(chan *Request, 100)
 
 	logStream := fs.NewDroppingStream(8192)
 	cmdStream := fs.NewDroppingStream(1024)
-	acmeDlvFs, root := fs.NewFS(user, group, 0440)
+	acmeDlvFs, root := fs.NewFS(user, group, 0550)
 	root.AddChild(fs.NewStreamFile(
 		acmeDlvFs.NewStat("log", user, group, 0440),
 		logStream,
@@ -49,6 +55,32 @@ func Serve() *AcmeSrv {
 		acmeDlvFs.NewStat("cmd", user, group, 0220),
 		cmdStream,
 	))
+	// Each open of rpc takes one command and replies with its result, for callers that need to
+	// know whether the command worked. The reply is "ok" or "error", followed by a space and any
+	// message.
+	root.AddChild(fs.NewPipeFile(
+		acmeDlvFs.NewStat("rpc", user, group, 0660),
+		func(st fs.BiDiStream) {
+			cmd, err := bufio.NewReader(st).ReadString('\n')
+			if err != nil && cmd == "" {
+				return
+			}
+			req := &Request{Cmd: strings.TrimSpace(cmd), Reply: make(chan Reply, 1)}
+			select {
+			case cmds <- req:
+			default:
+				req.Done("", fmt.Errorf("Dropping command %s. Command queue full.", req.Cmd))
+			}
+			r := <-req.Reply
+			if r.Err != nil {
+				fmt.Fprintf(st, "error %v\n", r.Err)
+				return
+			}
+			fmt.Fprintf(st, "ok %s\n", r.Msg)
+		},
+	))
+	sessions := fs.NewStaticDir(acmeDlvFs.NewStat("sessions", user, group, 0550|proto.DMDIR))
+	root.AddChild(sessions)
 
 	go func() {
 		for {
@@ -67,7 +99,7 @@ func Serve() *AcmeSrv {
 				log.Fatalf("Failed to read from command stream: %v", err)
 			}
 			select {
-			case cmds <- strings.TrimSpace(cmd):
+			case cmds <- &Request{Cmd: strings.TrimSpace(cmd)}:
 			default:
 				log.Printf("Dropping command %s. Command queue full.", cmd)
 			}
@@ -76,26 +108,47 @@ func Serve() *AcmeSrv {
 
 	//go9p.Serve("localhost:9999", acmeDlvFs.Server())
 	go func() {
-		log.Fatalf("AcmeSrv shut down: %v", go9p.PostSrv("acme-dlv", acmeDlvFs.Server()))
+		log.Fatalf("AcmeSrv shut down: %v", go9p.PostSrv(name, acmeDlvFs.Server()))
 	}()
 
 	return &AcmeSrv{
-		log:  logChan,
-		cmds: cmds,
+		log:      logChan,
+		cmds:     cmds,
+		fs:       acmeDlvFs,
+		user:     user,
+		group:    group,
+		sessions: sessions,
 	}
 }
 
 func (s *AcmeSrv) Log(format string, a ...interface{}) {
-	s.log <- fmt.Sprintf(format, a...)
+	select {
+	case s.log <- fmt.Sprintf(format, a...):
+	default:
+	}
 }
 
-func (s *AcmeSrv) Cmds() <-chan string {
+func (s *AcmeSrv) Cmds() <-chan *Request {
 	return s.cmds
 }
 
 var bp = flag.Bool("b", false, "Causes acme-dlv to send a breakpoint to an already running acme-dlv. Must be run on an acme window.")
 var bpd = flag.Bool("d", false, "Opposite of -b, deletes a breakpoint. Must be run on an acme window.")
+var bpCond = flag.String("c", "", "With -b, only stop at the breakpoint when this expression is true.")
+var bpHitCond = flag.String("hit", "", "With -b, only stop at the breakpoint when its hit count satisfies this condition, such as '> 10' or '% 2'.")
+var bpTrace = flag.Bool("trace", false, "With -b, set a tracepoint, which prints the function and its arguments each time it is hit instead of stopping.")
+var bpLog = flag.String("log", "", "With -b, set a logpoint, which prints this message each time it is hit instead of stopping. Each {expr} in the message is replaced by the value of expr.")
+var watchSel = flag.Bool("w", false, "Causes acme-dlv to watch the selected expression in a running acme-dlv session, showing its value each time the target stops. Must be run on an acme window.")
+var watchPoint = flag.Bool("wp", false, "Causes acme-dlv to set a watchpoint on the selected expression in a stopped acme-dlv session, stopping the target when the expression is written. An argument of r, w or rw chooses whether reads, writes or both stop it. Must be run on an acme window.")
+var runToCursor = flag.Bool("r", false, "Causes acme-dlv to continue the target in a running acme-dlv session until it reaches the line at the cursor. Must be run on an acme window.")
 var xamine = flag.Bool("x", false, "Causes acme-dlv to examine a variable in a stopped acme-dlv session. Must be run on an acme window.")
+var newSession = flag.Bool("n", false, "Causes acme-dlv to start a new debug session in an already running acme-dlv, in the current directory. The arguments select the mode: test [test flags...], debug [pkg [args...]], exec <binary> [args...], attach <pid>, core <exe> <core>, or connect <addr> to use a headless dlv that is already running. The default is test.")
+var runTest = flag.Bool("t", false, "Causes acme-dlv to start a new debug session in an already running acme-dlv, running only the test at the cursor or the selected test name. Must be run on an acme window.")
+var srvName = flag.String("srv", "acme-dlv", "The name acme-dlv posts its service under in the namespace, and that the other flags send commands to. Give each acme-dlv its own name to run several side by side.")
+var srvUser = flag.String("user", "", "The user owning the service's files, and that commands are sent as. The default is the current user.")
+var srvGroup = flag.String("group", "", "The group of the service's files. The default is the current user's primary group.")
+var timeout = flag.Duration("timeout", 5*time.Minute, "How long to wait for dlv to start, including building the program.")
+var record = flag.String("record", "", "Record the events of each debug session window to this file, with the session's number appended, so they can be replayed with acmetools.Replayer.")
 
 func main() {
 	flag.Parse()
@@ -105,16 +158,60 @@ func main() {
 		log.Fatalf("Failed to connect to acme: %v", err)
 	}
 
+	if *newSession {
+		dir, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Failed to get working directory: %v", err)
+		}
+		args := flag.Args()
+		mode := ModeTest
+		if len(args) > 0 {
+			mode = args[0]
+			args = args[1:]
+		}
+		switch mode {
+		case ModeTest, ModeDebug, ModeExec, ModeAttach, ModeCore, ModeConnect:
+		default:
+			log.Fatalf("Unknown session mode %s", mode)
+		}
+		cfg, err := ParseNew(joinArgs(append([]string{mode, dir}, args...)))
+		if err != nil {
+			log.Fatalf("Bad session: %v", err)
+		}
+		msg, err := call(cfg.String())
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Println(msg)
+		return
+	}
+
+	if *runTest {
+		dir, names, err := testAtCursor(a)
+		if err != nil {
+			log.Fatalf("Failed to find test: %v", err)
+		}
+		cfg := SessionConfig{Mode: ModeTest, Dir: dir, Args: []string{"-test.run", testRunPattern(names)}}
+		msg, err := call(cfg.String())
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Println(msg)
+		return
+	}
+
 	if *bp {
 		f, l, err := getFileLine(a)
 		if err != nil {
 			log.Fatalf("Failed to get line for breakpoint: %v", err)
 		}
 		//fmt.Printf(" GOT BREAK AT %s %v\n", f, l)
-		err = writeCommand(fmt.Sprintf("BreakFile %s %d", f, l))
+		opts := BreakOpts{Cond: *bpCond, HitCond: *bpHitCond, Trace: *bpTrace, Log: *bpLog}
+		msg, err := call("BreakFile " + joinArgs(append([]string{f, strconv.Itoa(l)}, opts.Args()...)))
 		if err != nil {
-			log.Fatalf("Failed to write command: %v", err)
+			log.Fatalf("%v", err)
 		}
+		fmt.Println(msg)
 		return
 	}
 
@@ -124,40 +221,91 @@ func main() {
 			log.Fatalf("Failed to get line for breakpoint: %v", err)
 		}
 		//fmt.Printf(" GOT BREAK AT %s %v\n", f, l)
-		err = writeCommand(fmt.Sprintf("DelBreakFile %s %d", f, l))
+		msg, err := call("DelBreakFile " + joinArgs([]string{f, strconv.Itoa(l)}))
 		if err != nil {
-			log.Fatalf("Failed to write command: %v", err)
+			log.Fatalf("%v", err)
 		}
+		fmt.Println(msg)
 		return
 	}
 
-	if *xamine {
-		winid := os.Getenv("winid")
-		if winid == "" {
-			log.Fatalf("Could not find acme window. $winid not set.")
+	if *runToCursor {
+		f, l, err := getFileLine(a)
+		if err != nil {
+			log.Fatalf("Failed to get line: %v", err)
+		}
+		msg, err := call("RunToCursor " + joinArgs([]string{f, strconv.Itoa(l)}))
+		if err != nil {
+			log.Fatalf("%v", err)
 		}
+		fmt.Println(msg)
+		return
+	}
 
-		w, err := a.GetWindow(winid)
+	if *watchSel {
+		w, fname, err := currentWindow(a)
+		if err != nil {
+			log.Fatalf("Failed to get window: %v", err)
+		}
+		s, err := w.Selected()
+		if err != nil {
+			log.Fatalf("Failed to read selection: %v", err)
+		}
+		msg, err := call(fmt.Sprintf("@%s Watch %s", fname, strings.TrimSpace(s)))
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Println(msg)
+		return
+	}
+
+	if *watchPoint {
+		w, fname, err := currentWindow(a)
 		if err != nil {
-			//fmt.Printf("FATAL: %s\n", err)
-			//os.Exit(1)
 			log.Fatalf("Failed to get window: %v", err)
 		}
 		s, err := w.Selected()
 		if err != nil {
-			//fmt.Printf("FATAL: %s\n", err)
+			log.Fatalf("Failed to read selection: %v", err)
+		}
+		cmd := fmt.Sprintf("@%s WatchPoint %s", fname, strings.TrimSpace(s))
+		if len(flag.Args()) > 0 {
+			cmd += " " + flag.Arg(0)
+		}
+		msg, err := call(cmd)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Println(msg)
+		return
+	}
+
+	if *xamine {
+		w, fname, err := currentWindow(a)
+		if err != nil {
+			log.Fatalf("Failed to get window: %v", err)
+		}
+		s, err := w.Selected()
+		if err != nil {
+			//fmt.Printf("FATAL: %s\n", err)
 			//os.Exit(1)
 			log.Fatalf("Failed to read selection: %v", err)
 		}
 		//fmt.Printf("SELECTED: [%s]\n", s)
-		err = writeCommand(fmt.Sprintf("X %s", s))
+		msg, err := call(fmt.Sprintf("@%s X %s", fname, s))
 		if err != nil {
-			log.Fatalf("Failed to write command: %v", err)
+			log.Fatalf("%v", err)
 		}
+		fmt.Println(msg)
 		return
 	}
 
-	as := Serve()
+	owner, group, err := serviceOwner()
+	if err != nil {
+		log.Fatalf("Failed to find service owner: %v", err)
+	}
+	as := Serve(*srvName, owner, group)
+	var router Router
 
 	// 	w, err := a.NewWindow()
 	// 	if err != nil {
@@ -177,68 +325,285 @@ func main() {
 
 	for {
 		select {
-		case cmd := <-as.Cmds():
+		case req := <-as.Cmds():
+			cmd := req.Cmd
 			// 			a.Log("Got Command: [%s]\n", cmd)
 			// 			as.Log("Got Command: [%s]\n", cmd)
 
 			if strings.HasPrefix(cmd, "New") {
-				arg := strings.TrimSpace(strings.TrimPrefix(cmd, "New"))
-				fi, err := os.Stat(arg)
+				cfg, err := ParseNew(strings.TrimPrefix(cmd, "New"))
 				if err != nil {
-					a.Log("Failed to find directory %s: %v\n", arg, err)
+					a.Log("%v\n", err)
+					req.Done("", err)
 					continue
 				}
-				if !fi.IsDir() {
-					a.Log("%s is not a directory.\n", arg)
-					continue
+				s := router.Add(cfg)
+				err = as.AddSession(s)
+				if err != nil {
+					a.Log("Failed to serve session %d: %v\n", s.ID, err)
 				}
-				RunDlvWin(a, arg, as.Cmds())
-			} else {
-				a.Log("[%s]\nNo active debug session running. Please start one before setting breakpoints.\n", cmd)
+				as.Log("session %d started: %s\n", s.ID, cfg)
+				req.Done(fmt.Sprintf("Session %d started in %s", s.ID, s.Name), nil)
+				go func() {
+					defer as.Log("session %d ended\n", s.ID)
+					defer as.RemoveSession(s)
+					defer router.Remove(s)
+					RunDlvWin(a, s)
+				}()
+			} else if err := router.Route(req); err != nil {
+				as.Log("%s: %v\n", cmd, err)
+				a.Log("[%s]\n%v\n", cmd, err)
+				req.Done("", err)
 			}
 		}
 	}
 }
 
-func RunDlvWin(a *acmetools.Acme, dir string, cmds <-chan string) {
+func RunDlvWin(a *acmetools.Acme, sess *Session) {
+	cfg := sess.Config
+	cmds := sess.Cmds
+	dir := cfg.Dir
 	defer log.Printf("Shut down DLV window for %s\n", dir)
-	win, err := a.NewWindow()
+	ow, err := a.OutputWindow(sess.Name)
 	if err != nil {
 		a.Log("Failed to create dlv window: %v", err)
 		return
 	}
-	win.AppendTag(fmt.Sprintf("| (Debugging Tests %s)\nRestart Continue Stop\nBreaks\tDelBreak\nNext\tStep\tX", dir))
+	defer ow.Close()
+	win := ow.Window()
+	win.Ctl("cleartag")
+	win.AppendTag(cfg.Tag())
 	defer win.AppendTag("(DEFUNCT)")
 
-	body, err := win.Body()
+	// The window is a terminal for dlv and the program being debugged. Everything typed after
+	// the output point is sent to the program's stdin.
+	body, err := acmetools.NewTerm(win)
 	if err != nil {
-		a.Log("Failed to write to body: %v\n", err)
+		a.Log("Failed to open terminal for dlv window: %v", err)
 		return
 	}
+	defer body.Close()
+	body.Tee(sess.Output)
 
-	es, err := win.Events()
+	var es *acmetools.EventStream
+	if *record != "" {
+		// Each session records to a file of its own, since a recording holds a single window.
+		f, err := os.OpenFile(fmt.Sprintf("%s.%d", *record, sess.ID), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(body, "Failed to open recording: %v\n", err)
+			return
+		}
+		defer f.Close()
+		es, err = win.RecordEvents(acmetools.NewRecorder(f))
+	} else {
+		es, err = win.Events()
+	}
 	if err != nil {
 		fmt.Fprintf(body, "Failed to get events stream: %v\n", err)
 		return
 	}
 	defer es.Close()
 
-	port, err := LaunchTestDlv(dir, body, body)
+	// tests are the results of a test session's tests, if they can be followed.
+	var tests *testResults
+	testOut := ""
+	if cfg.Mode == ModeTest {
+		tests, err = startTestResults(dir, body, func() {
+			select {
+			case cmds <- &Request{Cmd: "Tests"}:
+			default:
+			}
+		})
+		if err != nil {
+			fmt.Fprintf(body, "Failed to follow test results: %v\n", err)
+		} else {
+			defer tests.Close()
+			testOut = tests.fifo
+		}
+	}
+
+	dlv, err := LaunchDlv(cfg, body, testOut)
+	if err != nil {
+		fmt.Fprintf(body, "Failed to launch Delve: %v\n", err)
+		return
+	}
+
+	// target is the pid of the target, once it's known, if it is to be killed with dlv when the
+	// session ends. A target the session attached to, or that it detached from, is left running.
+	target := 0
+	defer func() {
+		dlv.Stop(target)
+	}()
+
+	conn, err := net.DialTimeout("tcp", dlv.Addr, *timeout)
 	if err != nil {
-		a.Log("Failed to launch Delve Test: %v", err)
+		fmt.Fprintf(body, "Failed to connect to Delve: %v\n", err)
 		return
 	}
+	c := rpc2.NewClientFromConn(conn)
+	ownTarget := cfg.Mode != ModeAttach && cfg.Mode != ModeConnect && cfg.Mode != ModeCore
+	// trackTarget records the pid of the target, which changes each time it is restarted.
+	trackTarget := func() {
+		if ownTarget {
+			target = c.ProcessPid()
+		}
+	}
+	trackTarget()
+
+	// confirmDel keeps the warning Del gives before it kills the running target.
+	var confirmDel delConfirm
+
+	// rerun is set while RerunFailed's arguments are in effect, so that Restart goes back to the
+	// session's own.
+	rerun := false
+
+	// detached is set once the Detach command has left the target running, and the session
+	// should end.
+	detached := false
+	defer func() {
+		if detached {
+			return
+		}
+		if cfg.Mode == ModeConnect {
+			// The dlv belongs to someone else.
+			c.Disconnect(false)
+			return
+		}
+		st, err := c.GetStateNonBlocking()
+		if err == nil && st.Running {
+			c.Halt()
+		}
+		if err == nil && st.Exited {
+			// dlv has reaped the target, and its pid may belong to another process by now.
+			target = 0
+		}
+		// dlv exits once it has detached.
+		c.Detach(ownTarget)
+	}()
+	retLoad := fileLoad
+	c.SetReturnValuesLoadConfig(&retLoad)
+	sess.setClient(c)
+	defer sess.setClient(nil)
+
+	aux := newAuxWindows(a, sess)
+	defer aux.Close()
+
+	// stopped returns the target's state, or an error if the target can't be inspected because it
+	// isn't stopped.
+	stopped := func() (*api.DebuggerState, error) {
+		_, st, msg := sess.stopped()
+		if st == nil {
+			return nil, fmt.Errorf("Can't inspect the target: %s", strings.TrimSpace(msg))
+		}
+		return st, nil
+	}
+
+	var watches watchList
+
+	// showWatches evaluates the watch expressions in scope and shows them in the watch window.
+	showWatches := func(scope api.EvalScope) error {
+		watches.Eval(c, scope)
+		return aux.Show("watch", "", "Watches", "", false, "Watches\n\n"+watches.String())
+	}
 
-	c := rpc2.NewClient(fmt.Sprintf("localhost:%d", port))
-	defer c.Disconnect(false)
+	var explore explorer
+
+	wps := make(watchpoints)
+
+	// cursorBP is the temporary breakpoint set by RunToCursor, if any.
+	cursorBP := 0
+	clearCursor := func() {
+		if cursorBP != 0 {
+			c.ClearBreakpoint(cursorBP)
+			cursorBP = 0
+		}
+	}
+
+	breaks := NewBreakpoints(sess.Root, c)
+	err = breaks.Restore(body)
+	if err != nil {
+		fmt.Fprintf(body, "Failed to restore breakpoints: %v\n", err)
+	}
+
+	// reportTraces prints the tracepoints and logpoints hit in s, and reports whether they are all
+	// that stopped the target. dlv continues past them by itself.
+	reportTraces := func(s *api.DebuggerState) bool {
+		traced := false
+		for _, th := range s.Threads {
+			bp := th.Breakpoint
+			if bp == nil {
+				continue
+			}
+			if !bp.Tracepoint {
+				return false
+			}
+			traced = true
+			info := th.BreakpointInfo
+			if info == nil {
+				info = &api.BreakpointInfo{}
+			}
+			if msg := breaks.Log(bp.ID); msg != "" {
+				fmt.Fprintf(body, "%s:%d: %s\n", th.File, th.Line, formatLog(msg, info.Variables))
+				continue
+			}
+			var args []string
+			for _, v := range info.Arguments {
+				args = append(args, fmt.Sprintf("%s=%s", v.Name, v.SinglelineString()))
+			}
+			fmt.Fprintf(body, "> %s(%s) %s:%d\n", th.Function.Name(), strings.Join(args, ", "), th.File, th.Line)
+		}
+		return traced && !s.Exited && s.Err == nil
+	}
+
+	// printLocals prints the local variables of scope.
+	printLocals := func(scope api.EvalScope) {
+		vars, err := c.ListLocalVariables(scope, api.LoadConfig{
+			FollowPointers:     false,
+			MaxVariableRecurse: 0,
+			MaxStringLen:       20,
+			MaxArrayValues:     5,
+			MaxStructFields:    0,
+		})
+		if err != nil {
+			fmt.Fprintf(body, "Error getting local vars: %v\n", err)
+			return
+		}
+		fmt.Fprintf(body, "Vars:\n")
+		for _, v := range vars {
+			//					fmt.Printf("\t%s (%s): %s\n", v.Name, v.Type, v.Value)
+			fmt.Fprintf(body, "\t%s = %s\n", v.Name, v.SinglelineString())
+		}
+	}
 
 	handleDebuggerState := func(s *api.DebuggerState) {
 		//fmt.Printf("GOT STATE: ")
 		spew.Dump(s)
+		if reportTraces(s) {
+			return
+		}
+		confirmDel.Reset()
+		sess.setFrame(0)
+		clearCursor()
+		for _, bp := range s.WatchOutOfScope {
+			fmt.Fprintf(body, "Watchpoint %d on %s went out of scope and was cleared.\n", bp.ID, bp.WatchExpr)
+			delete(wps, bp.ID)
+		}
 		if s.CurrentThread != nil {
 			bp := s.CurrentThread.Breakpoint
 			if bp != nil {
-				if bp.ID == -1 {
+				if bp.WatchExpr != "" {
+					th := s.CurrentThread
+					old, now := wps.Hit(c, sess.Scope(s), bp)
+					if old == now {
+						fmt.Fprintf(body, "Watchpoint %d: %s:%d accessed %s = %s\n", bp.ID, th.File, th.Line, bp.WatchExpr, now)
+					} else {
+						fmt.Fprintf(body, "Watchpoint %d: %s:%d changed %s from %s to %s\n", bp.ID, th.File, th.Line, bp.WatchExpr, old, now)
+					}
+					err = acmetools.PlumbCmd(dir, fmt.Sprintf("%s:%d", th.File, th.Line))
+					if err != nil {
+						fmt.Fprintf(body, "Failed to plumb: %v\n", err)
+					}
+				} else if bp.ID == -1 {
 					// This is a panic or other non-user break.
 					//fmt.Printf("PANIC\n")
 					frames, err := c.Stacktrace(s.CurrentThread.GoroutineID, 1000, api.StacktraceSimple, &api.LoadConfig{
@@ -269,22 +634,17 @@ func RunDlvWin(a *acmetools.Acme, dir string, cmds <-chan string) {
 					fmt.Fprintf(body, "Failed to plumb: %v\n", err)
 				}
 			}
-			vars, err := c.ListLocalVariables(api.EvalScope{GoroutineID: s.CurrentThread.GoroutineID}, api.LoadConfig{
-				FollowPointers:     false,
-				MaxVariableRecurse: 0,
-				MaxStringLen:       20,
-				MaxArrayValues:     5,
-				MaxStructFields:    0,
-			})
-			if err != nil {
-				fmt.Fprintf(body, "Error getting local vars: %v\n", err)
-			} else {
-				fmt.Fprintf(body, "Vars:\n")
-				for _, v := range vars {
-					//					fmt.Printf("\t%s (%s): %s\n", v.Name, v.Type, v.Value)
-					fmt.Fprintf(body, "\t%s = %s\n", v.Name, v.SinglelineString())
+			printLocals(sess.Scope(s))
+			if watches.Len() > 0 {
+				err := showWatches(sess.Scope(s))
+				if err != nil {
+					fmt.Fprintf(body, "Failed to show watches: %v\n", err)
 				}
 			}
+			aux.Refresh("goroutines")
+			aux.Refresh("stack")
+			aux.Refresh("disasm")
+			aux.Refresh("regs")
 		}
 
 		if s.Err != nil {
@@ -292,147 +652,305 @@ func RunDlvWin(a *acmetools.Acme, dir string, cmds <-chan string) {
 		}
 	}
 
-	handleCommand := func(next <-chan *api.DebuggerState, cmd string) <-chan *api.DebuggerState {
+	// handleCommand runs cmd. Messages about the command are written to out, and failures are
+	// returned.
+	handleCommand := func(next <-chan *api.DebuggerState, cmd string, out io.Writer) (<-chan *api.DebuggerState, error) {
 		fmt.Printf("Handling [%s]\n", cmd)
 		if cmd == "Continue" {
-			fmt.Fprintf(body, "Continuing\n")
+			fmt.Fprintf(out, "Continuing\n")
 			c := c.Continue()
-			return c
+			return c, nil
 		}
 
 		if cmd == "Restart" {
-			fmt.Fprintf(body, "Restarting\n")
-			bps, err := c.Restart(true)
+			fmt.Fprintf(out, "Restarting\n")
+			var discarded []api.DiscardedBreakpoint
+			var err error
+			if rerun {
+				args := append(cfg.Args[:len(cfg.Args):len(cfg.Args)], "-test.v=test2json")
+				discarded, err = c.RestartFrom(false, "", true, args, [3]string{"", tests.fifo, ""}, true)
+			} else {
+				discarded, err = c.Restart(true)
+			}
 			if err != nil {
-				fmt.Fprintf(body, "Failed to restart target: %v\n", err)
-				return next
+				return next, fmt.Errorf("Failed to restart target: %w", err)
 			}
-			for _, bp := range bps {
-				fmt.Fprintf(body, "Removed %s:%d : %s\n", bp.Breakpoint.File, bp.Breakpoint.Line, bp.Reason)
+			rerun = false
+			trackTarget()
+			if tests != nil {
+				tests.Reset()
+			}
+			err = breaks.Restarted(out, discarded)
+			if err != nil {
+				return next, fmt.Errorf("Failed to restore breakpoints: %w", err)
+			}
+			return next, nil
+		}
+
+		if cmd == "Detach" {
+			if cfg.Mode == ModeConnect {
+				c.Disconnect(false)
+				fmt.Fprintf(out, "Disconnected from %s, which is left running.\n", cfg.Args[0])
+				detached = true
+				return next, nil
+			}
+			if st, err := c.GetStateNonBlocking(); err == nil && st.Running {
+				_, err := c.Halt()
+				if err != nil {
+					return next, fmt.Errorf("Failed to halt before detaching: %w", err)
+				}
+			}
+			pid := c.ProcessPid()
+			err := c.Detach(false)
+			if err != nil {
+				return next, fmt.Errorf("Failed to detach: %w", err)
+			}
+			fmt.Fprintf(out, "Detached from process %d, which is left running.\n", pid)
+			detached = true
+			target = 0
+			return next, nil
+		}
+
+		if cmd == "Tests" || cmd == "RerunFailed" {
+			if tests == nil {
+				return next, fmt.Errorf("%s needs a test session.", cmd)
 			}
-			return next
+		}
+
+		if cmd == "Tests" {
+			err := aux.Show("tests", " RerunFailed", "Tests", "", false, tests.String())
+			if err != nil {
+				return next, fmt.Errorf("Failed to show test results: %w", err)
+			}
+			return next, nil
+		}
+
+		if cmd == "RerunFailed" {
+			failed := tests.Failed()
+			if len(failed) == 0 {
+				return next, fmt.Errorf("No tests have failed.")
+			}
+			args := append(withoutRunFlag(cfg.Args), "-test.run", failedRunPattern(failed), "-test.v=test2json")
+			fmt.Fprintf(out, "Restarting to run %s\n", strings.Join(failed, " "))
+			discarded, err := c.RestartFrom(false, "", true, args, [3]string{"", tests.fifo, ""}, true)
+			if err != nil {
+				return next, fmt.Errorf("Failed to restart target: %w", err)
+			}
+			rerun = true
+			trackTarget()
+			tests.Reset()
+			err = breaks.Restarted(out, discarded)
+			if err != nil {
+				return next, fmt.Errorf("Failed to restore breakpoints: %w", err)
+			}
+			return next, nil
 		}
 
 		if strings.HasPrefix(cmd, "BreakFile ") {
-			args := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(cmd, "BreakFile")), " ", 2)
-			line, err := strconv.Atoi(strings.TrimSpace(args[1]))
-			if err != nil {
-				fmt.Fprintf(body, "Failed to parse breakpoint: %v\n", err)
-				fmt.Fprintf(body, "\t[%v]\n", cmd)
-				return next
-			}
-			fname := strings.TrimSpace(args[0])
-			// 			fmt.Fprintf(body, "Cmd: %v\n", cmd)
-			// 			fmt.Fprintf(body, "\t[%v]\n", args)
-			// 			fmt.Fprintf(body, "\t[%v]\n", line)
-			bp, err := c.CreateBreakpoint(&api.Breakpoint{
-				//Name: fmt.Sprintf("%s:%d", fname, line),
-				File: fname,
-				Line: line,
-			})
+			args := splitArgs(strings.TrimPrefix(cmd, "BreakFile"))
+			if len(args) < 2 {
+				return next, fmt.Errorf("Failed to parse breakpoint: [%v]", cmd)
+			}
+			line, err := strconv.Atoi(args[1])
 			if err != nil {
-				fmt.Fprintf(body, "Failed to set breakpoint: %v\n", err)
-				return next
+				return next, fmt.Errorf("Failed to parse breakpoint: %w\n\t[%v]", err, cmd)
 			}
-			fmt.Fprintf(body, "Breakpoint set: %s:%d\n", bp.File, bp.Line)
-			return next
+			fname := args[0]
+			opts, rest, err := parseBreakOpts(args[2:])
+			if err != nil {
+				return next, fmt.Errorf("Failed to parse breakpoint: %w\n\t[%v]", err, cmd)
+			}
+			if len(rest) > 0 {
+				return next, fmt.Errorf("Failed to parse breakpoint: unexpected %s\n\t[%v]", rest[0], cmd)
+			}
+			bp, err := breaks.Create(fname, line, opts)
+			if err != nil {
+				return next, fmt.Errorf("Failed to set breakpoint: %w", err)
+			}
+			kind := "Breakpoint"
+			if opts.Log != "" {
+				kind = "Logpoint"
+			} else if opts.Trace {
+				kind = "Tracepoint"
+			}
+			fmt.Fprintf(out, "%s %d set at %s:%d\n", kind, bp.ID, bp.File, bp.Line)
+			return next, nil
 		}
 
 		if strings.HasPrefix(cmd, "DelBreakFile ") {
-			args := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(cmd, "DelBreakFile")), " ", 2)
-			line, err := strconv.Atoi(strings.TrimSpace(args[1]))
+			args := splitArgs(strings.TrimPrefix(cmd, "DelBreakFile"))
+			if len(args) != 2 {
+				return next, fmt.Errorf("Failed to parse breakpoint: [%v]", cmd)
+			}
+			line, err := strconv.Atoi(args[1])
 			if err != nil {
-				fmt.Fprintf(body, "Failed to parse breakpoint: %v\n", err)
-				fmt.Fprintf(body, "\t[%v]\n", cmd)
-				return next
+				return next, fmt.Errorf("Failed to parse breakpoint: %w\n\t[%v]", err, cmd)
 			}
-			fname := strings.TrimSpace(args[0])
-			// 			fmt.Fprintf(body, "Cmd: %v\n", cmd)
-			// 			fmt.Fprintf(body, "\t[%v]\n", args)
-			// 			fmt.Fprintf(body, "\t[%v]\n", line)
+			fname := args[0]
 			bps, err := c.ListBreakpoints(false)
 			if err != nil {
-				fmt.Fprintf(body, "Failed to list breakpoints: %v\n", err)
-				return next
+				return next, fmt.Errorf("Failed to list breakpoints: %w", err)
 			}
 			for _, bp := range bps {
 				if fmt.Sprintf("%s:%d", fname, line) == fmt.Sprintf("%s:%d", bp.File, bp.Line) {
-					//fmt.Fprintf(body, "Deleting breakpoint %d\n", bp.ID)
-					//c.ClearBreakpointByName(fmt.Sprintf("%s:%d", fname, line))
-					bp, err := c.ClearBreakpoint(bp.ID)
+					bp, err := breaks.Clear(bp.ID)
 					if err != nil {
-						fmt.Fprintf(body, "Failed to clear breakpoint: %v\n", err)
-						return next
+						return next, fmt.Errorf("Failed to clear breakpoint: %w", err)
 					}
-					fmt.Fprintf(body, "Breakpoint %d cleared: %s:%d\n", bp.ID, bp.File, bp.Line)
-					return next
+					fmt.Fprintf(out, "Breakpoint %d cleared: %s:%d\n", bp.ID, bp.File, bp.Line)
+					return next, nil
 				}
 			}
-			fmt.Fprintf(body, "Breakpoint not found.\n")
-			return next
+			forgot, err := breaks.Forget(fname, line)
+			if err != nil {
+				return next, err
+			}
+			if forgot {
+				fmt.Fprintf(out, "Saved breakpoint forgotten: %s:%d\n", fname, line)
+				return next, nil
+			}
+			return next, fmt.Errorf("No breakpoint at %s:%d.", fname, line)
+		}
+
+		if cmd == "Cond" || strings.HasPrefix(cmd, "Cond ") {
+			bpn, hitCond, cond, err := parseCond(strings.TrimPrefix(cmd, "Cond"))
+			if err != nil {
+				return next, err
+			}
+			bp, err := breaks.Amend(bpn, cond, hitCond)
+			if err != nil {
+				return next, fmt.Errorf("Failed to change breakpoint: %w", err)
+			}
+			fmt.Fprintf(out, "Breakpoint %d at %s:%d: %s\n", bp.ID, bp.File, bp.Line, describeConds(bp))
+			return next, nil
 		}
 
 		if strings.HasPrefix(cmd, "DelBreak ") {
 			arg := strings.TrimSpace(strings.TrimPrefix(cmd, "DelBreak "))
 			bpn, err := strconv.Atoi(arg)
 			if err != nil {
-				fmt.Fprintf(body, "Expected a breakpoint number, but found \"%v\": %v\n", arg, err)
+				return next, fmt.Errorf("Expected a breakpoint number, but found \"%v\": %w", arg, err)
 			}
-			bp, err := c.ClearBreakpoint(bpn)
+			bp, err := breaks.Clear(bpn)
 			if err != nil {
-				fmt.Fprintf(body, "Failed to clear breakpoint: %v\n", err)
-				return next
+				return next, fmt.Errorf("Failed to clear breakpoint: %w", err)
 			}
-			fmt.Fprintf(body, "Breakpoint cleared: %s:%d\n", bp.File, bp.Line)
+			fmt.Fprintf(out, "Breakpoint cleared: %s:%d\n", bp.File, bp.Line)
+			return next, nil
 		}
 
 		if strings.HasPrefix(cmd, "Breaks") {
 			bps, err := c.ListBreakpoints(false)
 			if err != nil {
-				fmt.Fprintf(body, "Failed to list breakpoints: %v\n", err)
-				return next
+				return next, fmt.Errorf("Failed to list breakpoints: %w", err)
 			}
-			fmt.Printf("Breakpoints:\n")
+			fmt.Fprintf(out, "Breakpoints:\n")
 			for _, bp := range bps {
-				fmt.Fprintf(body, "(%d): %s\n", bp.ID, bp.Name)
-				fmt.Fprintf(body, "\t(0x%016X): %s\n", bp.Addr, bp.FunctionName)
-				fmt.Fprintf(body, "\t%s:%d\n", bp.File, bp.Line)
+				fmt.Fprintf(out, "(%d): %s\n", bp.ID, bp.Name)
+				fmt.Fprintf(out, "\t(0x%016X): %s\n", bp.Addr, bp.FunctionName)
+				fmt.Fprintf(out, "\t%s:%d\n", bp.File, bp.Line)
+				if bp.WatchExpr != "" {
+					fmt.Fprintf(out, "\twatch %s %s\n", bp.WatchExpr, watchTypeString(bp.WatchType))
+				}
+				if bp.Cond != "" || bp.HitCond != "" {
+					fmt.Fprintf(out, "\t%s\n", describeConds(bp))
+				}
+				if msg := breaks.Log(bp.ID); msg != "" {
+					fmt.Fprintf(out, "\tlog %s\n", msg)
+				} else if bp.Tracepoint {
+					fmt.Fprintf(out, "\ttrace\n")
+				}
+				fmt.Fprintf(out, "\thit %d times\n", bp.TotalHitCount)
+			}
+			if lost := breaks.Lost(); len(lost) > 0 {
+				fmt.Fprintf(out, "Saved, but not set (DelBreakFile <file> <line> forgets one):\n")
+				for _, sb := range lost {
+					fmt.Fprintf(out, "\t%s:%d\n", sb.File, sb.Line)
+				}
 			}
+			return next, nil
 		}
 
 		if strings.HasPrefix(cmd, "Stop") {
 			ds, err := c.Halt()
 			if err != nil {
-				fmt.Fprintf(body, "Failed to halt.\n")
+				return next, fmt.Errorf("Failed to halt: %w", err)
 			}
 			handleDebuggerState(ds)
+			return next, nil
 		}
 		if strings.HasPrefix(cmd, "Next") {
 			ds, err := c.Next()
 			if err != nil {
-				fmt.Fprintf(body, "Failed to next.\n")
+				return next, fmt.Errorf("Failed to next: %w", err)
+			}
+			handleDebuggerState(ds)
+			return next, nil
+		}
+		if cmd == "StepOut" {
+			ds, err := c.StepOut()
+			if err != nil {
+				return next, fmt.Errorf("Failed to step out: %w", err)
+			}
+			handleDebuggerState(ds)
+			return next, nil
+		}
+		if cmd == "StepInstruction" {
+			ds, err := c.StepInstruction()
+			if err != nil {
+				return next, fmt.Errorf("Failed to step instruction: %w", err)
 			}
 			handleDebuggerState(ds)
+			return next, nil
+		}
+		if strings.HasPrefix(cmd, "RunToCursor ") {
+			args := splitArgs(strings.TrimPrefix(cmd, "RunToCursor"))
+			if len(args) != 2 {
+				return next, fmt.Errorf("Usage: RunToCursor <file> <line>")
+			}
+			line, err := strconv.Atoi(args[1])
+			if err != nil {
+				return next, fmt.Errorf("Expected a line number, but found \"%v\": %w", args[1], err)
+			}
+			clearCursor()
+			bps, err := c.ListBreakpoints(false)
+			if err != nil {
+				return next, fmt.Errorf("Failed to list breakpoints: %w", err)
+			}
+			exists := false
+			for _, bp := range bps {
+				if bp.File == args[0] && bp.Line == line {
+					exists = true
+				}
+			}
+			if !exists {
+				bp, err := c.CreateBreakpoint(&api.Breakpoint{Name: cursorBreakpoint, File: args[0], Line: line})
+				if err != nil {
+					return next, fmt.Errorf("Failed to set breakpoint: %w", err)
+				}
+				cursorBP = bp.ID
+			}
+			fmt.Fprintf(out, "Running to %s:%d\n", args[0], line)
+			return c.Continue(), nil
 		}
 		if strings.HasPrefix(cmd, "Step") {
 			ds, err := c.Step()
 			if err != nil {
-				fmt.Fprintf(body, "Failed to step.\n")
+				return next, fmt.Errorf("Failed to step: %w", err)
 			}
 			handleDebuggerState(ds)
+			return next, nil
 		}
 		if strings.HasPrefix(cmd, "X ") {
 			arg := strings.TrimSpace(strings.TrimPrefix(cmd, "X "))
 			s, err := c.GetState()
 			if err != nil {
-				fmt.Fprintf(body, "Failed to get debugger state: %v\n", err)
-				return next
+				return next, fmt.Errorf("Failed to get debugger state: %w", err)
 			}
-			if s.CurrentThread == nil {
-				fmt.Fprintf(body, "Failed to get current thread. It is nil.\n")
-				return next
+			if s.CurrentThread == nil && s.SelectedGoroutine == nil {
+				return next, fmt.Errorf("Failed to get current goroutine. It is nil.")
 			}
-			v, err := c.EvalVariable(api.EvalScope{GoroutineID: s.CurrentThread.GoroutineID}, arg, api.LoadConfig{
+			v, err := c.EvalVariable(sess.Scope(s), arg, api.LoadConfig{
 				FollowPointers:     true,
 				MaxVariableRecurse: 1000,
 				MaxStringLen:       2000,
@@ -440,38 +958,371 @@ func RunDlvWin(a *acmetools.Acme, dir string, cmds <-chan string) {
 				MaxStructFields:    100,
 			})
 			if err != nil {
-				fmt.Fprintf(body, "Error getting local vars: %v\n", err)
-				return next
-			}
-			fmt.Fprintf(body, "\t%s = %s\n", v.Name, v.MultilineString("\t", ""))
-
-			// 			vars, err := c.ListLocalVariables(api.EvalScope{GoroutineID: s.CurrentThread.GoroutineID}, api.LoadConfig{
-			// 				FollowPointers:     true,
-			// 				MaxVariableRecurse: 1000,
-			// 				MaxStringLen:       2000,
-			// 				MaxArrayValues:     50,
-			// 				MaxStructFields:    100,
-			// 			})
-			// 			if err != nil {
-			// 				fmt.Fprintf(body, "Error getting local vars: %v\n", err)
-			// 				return next
-			// 			}
-			// 			var found bool
-			// 			for _, v := range vars {
-			// 				//					fmt.Printf("\t%s (%s): %s\n", v.Name, v.Type, v.Value)
-			// 				if v.Name == arg {
-			// 					found = true
-			// 					fmt.Fprintf(body, "\t%s = %s\n", v.Name, v.MultilineString("\t", ""))
-			// 				}
-			// 			}
-			// 			if !found {
-			// 				fmt.Fprintf(body, "no such variable [%s] found.\nHave:\n", arg)
-			// 				for _, v := range vars {
-			// 					fmt.Fprintf(body, "\t%s\n", v.Name)
-			// 				}
-			// 			}
+				return next, fmt.Errorf("Failed to evaluate %s: %w", arg, err)
+			}
+			fmt.Fprintf(out, "\t%s = %s\n", v.Name, v.MultilineString("\t", ""))
+			return next, nil
+		}
+
+		if cmd == "Goroutines" || strings.HasPrefix(cmd, "Goroutines ") {
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			text, err := listGoroutines(c, splitArgs(strings.TrimPrefix(cmd, "Goroutines")), goroutineID(st))
+			if err != nil {
+				return next, fmt.Errorf("Failed to list goroutines: %w", err)
+			}
+			err = aux.Show("goroutines", "", cmd, "Goroutine", false, text)
+			if err != nil {
+				return next, fmt.Errorf("Failed to show goroutines: %w", err)
+			}
+			return next, nil
+		}
+
+		if strings.HasPrefix(cmd, "Goroutine ") {
+			arg := strings.TrimSpace(strings.TrimPrefix(cmd, "Goroutine "))
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return next, fmt.Errorf("Expected a goroutine number, but found \"%v\": %w", arg, err)
+			}
+			_, err = stopped()
+			if err != nil {
+				return next, err
+			}
+			st, err := c.SwitchGoroutine(id)
+			if err != nil {
+				return next, fmt.Errorf("Failed to switch goroutine: %w", err)
+			}
+			if g := st.SelectedGoroutine; g != nil {
+				loc := g.UserCurrentLoc
+				fmt.Fprintf(out, "Switched to goroutine %d at %s:%d %s\n", g.ID, loc.File, loc.Line, loc.Function.Name())
+				err = acmetools.PlumbCmd(dir, fmt.Sprintf("%s:%d", loc.File, loc.Line))
+				if err != nil {
+					fmt.Fprintf(body, "Failed to plumb: %v\n", err)
+				}
+			}
+			sess.setFrame(0)
+			aux.Refresh("goroutines")
+			aux.Refresh("stack")
+			aux.Refresh("disasm")
+			aux.Refresh("regs")
+			return next, nil
+		}
+
+		if strings.HasPrefix(cmd, "Watch ") || strings.HasPrefix(cmd, "Unwatch ") || cmd == "Watches" {
+			switch {
+			case strings.HasPrefix(cmd, "Watch "):
+				expr := strings.TrimSpace(strings.TrimPrefix(cmd, "Watch "))
+				n := watches.Add(expr)
+				fmt.Fprintf(out, "Watch %d: %s\n", n, expr)
+			case strings.HasPrefix(cmd, "Unwatch "):
+				arg := strings.TrimSpace(strings.TrimPrefix(cmd, "Unwatch "))
+				n, err := strconv.Atoi(arg)
+				if err != nil {
+					return next, fmt.Errorf("Expected a watch number, but found \"%v\": %w", arg, err)
+				}
+				if !watches.Remove(n) {
+					return next, fmt.Errorf("No watch %d.", n)
+				}
+				fmt.Fprintf(out, "Watch %d removed\n", n)
+			}
+			st, err := stopped()
+			if err != nil {
+				// The watches are evaluated when the target next stops.
+				return next, nil
+			}
+			err = showWatches(sess.Scope(st))
+			if err != nil {
+				return next, fmt.Errorf("Failed to show watches: %w", err)
+			}
+			return next, nil
+		}
+
+		if cmd == "Explore" || strings.HasPrefix(cmd, "Explore ") || strings.HasPrefix(cmd, "Expand ") || cmd == "More" || cmd == "Back" {
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			expr, push := explore.expr, false
+			switch {
+			case strings.HasPrefix(cmd, "Explore "):
+				expr, push = strings.TrimSpace(strings.TrimPrefix(cmd, "Explore ")), true
+			case strings.HasPrefix(cmd, "Expand "):
+				arg := strings.TrimSpace(strings.TrimPrefix(cmd, "Expand "))
+				n, err := strconv.Atoi(arg)
+				if err != nil {
+					return next, fmt.Errorf("Expected a child number, but found \"%v\": %w", arg, err)
+				}
+				expr, err = explore.Child(n)
+				if err != nil {
+					return next, err
+				}
+				push = true
+			case cmd == "More":
+				if explore.more == "" {
+					return next, fmt.Errorf("There is no more of %s.", explore.expr)
+				}
+				expr, push = explore.more, true
+			case cmd == "Back":
+				var ok bool
+				expr, ok = explore.Back()
+				if !ok {
+					return next, fmt.Errorf("Nothing to go back to.")
+				}
+			}
+			if expr == "" {
+				return next, fmt.Errorf("Usage: Explore <expr>")
+			}
+			text, err := explore.Explore(c, sess.Scope(st), expr, push)
+			if err != nil {
+				return next, fmt.Errorf("Failed to evaluate %s: %w", expr, err)
+			}
+			err = aux.Show("explore", " Back More", "Explore", "Expand", false, text)
+			if err != nil {
+				return next, fmt.Errorf("Failed to show %s: %w", expr, err)
+			}
+			return next, nil
+		}
+
+		if strings.HasPrefix(cmd, "Set ") {
+			name, value, ok := splitAssign(strings.TrimPrefix(cmd, "Set "))
+			if !ok || name == "" || value == "" {
+				return next, fmt.Errorf("Usage: Set <var> = <expr>")
+			}
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			scope := sess.Scope(st)
+			err = c.SetVariable(scope, name, value)
+			if err != nil {
+				return next, fmt.Errorf("Failed to set %s: %w", name, err)
+			}
+			v, err := c.EvalVariable(scope, name, fileLoad)
+			if err != nil {
+				return next, fmt.Errorf("Set %s, but failed to read it back: %w", name, err)
+			}
+			fmt.Fprintf(out, "%s = %s\n", name, v.SinglelineString())
+			return next, nil
+		}
+
+		if strings.HasPrefix(cmd, "Call ") {
+			// Call [-unsafe] <expr>
+			expr := strings.TrimSpace(strings.TrimPrefix(cmd, "Call "))
+			unsafe := false
+			if strings.HasPrefix(expr, "-unsafe ") {
+				unsafe = true
+				expr = strings.TrimSpace(strings.TrimPrefix(expr, "-unsafe "))
+			}
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			if frame := sess.Scope(st).Frame; frame != 0 {
+				// dlv injects calls at the top of the goroutine's stack.
+				fmt.Fprintf(out, "Calling from frame 0, not frame %d.\n", frame)
+			}
+			ds, err := c.Call(goroutineID(st), expr, unsafe)
+			if err != nil {
+				return next, fmt.Errorf("Failed to call %s: %w", expr, err)
+			}
+			if ds.Exited || ds.CurrentThread == nil || !ds.CurrentThread.CallReturn {
+				// The call stopped somewhere, such as at a breakpoint, or the target exited.
+				if ds.Exited {
+					fmt.Fprintf(out, "The target exited with status %d during the call.\n", ds.ExitStatus)
+				}
+				handleDebuggerState(ds)
+				return next, nil
+			}
+			fmt.Fprintf(out, "%s returned", expr)
+			rvs := ds.CurrentThread.ReturnValues
+			if len(rvs) == 0 {
+				fmt.Fprintf(out, " nothing")
+			}
+			fmt.Fprintf(out, "\n")
+			for _, v := range rvs {
+				fmt.Fprintf(out, "\t%s = %s\n", v.Name, summary(&v))
+			}
+			return next, nil
+		}
+
+		if cmd == "Stack" {
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			frames, err := c.Stacktrace(goroutineID(st), stackDepth, 0, nil)
+			if err != nil {
+				return next, fmt.Errorf("Failed to get stacktrace: %w", err)
+			}
+			err = aux.Show("stack", "", cmd, "Frame", false, formatStack(goroutineID(st), frames, sess.Scope(st).Frame))
+			if err != nil {
+				return next, fmt.Errorf("Failed to show stack: %w", err)
+			}
+			return next, nil
+		}
+
+		if cmd == "Disasm" || strings.HasPrefix(cmd, "Disasm ") {
+			// Disasm [addr]
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			scope := sess.Scope(st)
+			frames, err := c.Stacktrace(goroutineID(st), scope.Frame, 0, nil)
+			if err != nil {
+				return next, fmt.Errorf("Failed to get stacktrace: %w", err)
+			}
+			if scope.Frame >= len(frames) {
+				return next, fmt.Errorf("No frame %d.", scope.Frame)
+			}
+			pc := frames[scope.Frame].PC
+			addr := pc
+			if arg := strings.TrimSpace(strings.TrimPrefix(cmd, "Disasm")); arg != "" {
+				addr, err = strconv.ParseUint(arg, 0, 64)
+				if err != nil {
+					return next, fmt.Errorf("Expected an address, but found \"%v\": %w", arg, err)
+				}
+			}
+			insts, err := c.DisassemblePC(scope, addr, api.GoFlavour)
+			if err != nil {
+				return next, fmt.Errorf("Failed to disassemble %#x: %w", addr, err)
+			}
+			// The window is refilled at the pc, not the address clicked, when the target stops.
+			err = aux.Show("disasm", "", "Disasm", "Disasm", true, formatDisasm(insts, pc))
+			if err != nil {
+				return next, fmt.Errorf("Failed to show disassembly: %w", err)
+			}
+			return next, nil
+		}
+
+		if cmd == "Regs" || cmd == "Regs -fp" {
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			scope := sess.Scope(st)
+			regs, err := c.ListScopeRegisters(scope, cmd == "Regs -fp")
+			if err != nil {
+				return next, fmt.Errorf("Failed to get registers: %w", err)
+			}
+			err = aux.Show("regs", "", cmd, "", false, formatRegs(scope.GoroutineID, scope.Frame, regs))
+			if err != nil {
+				return next, fmt.Errorf("Failed to show registers: %w", err)
+			}
+			return next, nil
+		}
+
+		if strings.HasPrefix(cmd, "WatchPoint ") {
+			// WatchPoint <expr> [r|w|rw]
+			expr, typ := lastWord(strings.TrimPrefix(cmd, "WatchPoint "))
+			switch typ {
+			case "r", "w", "rw":
+			default:
+				expr, typ = strings.TrimSpace(strings.TrimPrefix(cmd, "WatchPoint ")), ""
+			}
+			if expr == "" {
+				return next, fmt.Errorf("Usage: WatchPoint <expr> [r|w|rw]")
+			}
+			t, err := parseWatchType(typ)
+			if err != nil {
+				return next, err
+			}
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			bp, err := wps.Create(c, sess.Scope(st), expr, t)
+			if err != nil {
+				return next, fmt.Errorf("Failed to set watchpoint on %s: %w", expr, err)
+			}
+			fmt.Fprintf(out, "Watchpoint %d set on %s (%s) = %s\n", bp.ID, expr, watchTypeString(t), wps[bp.ID].value)
+			return next, nil
+		}
+
+		if strings.HasPrefix(cmd, "Examine ") {
+			expr, n, format, err := parseExamine(strings.TrimPrefix(cmd, "Examine "))
+			if err != nil {
+				return next, err
+			}
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			scope := sess.Scope(st)
+			addr, err := examineAddress(c, scope, expr)
+			if err != nil {
+				return next, fmt.Errorf("Failed to find the address of %s: %w", expr, err)
+			}
+			mem, _, err := c.ExamineMemory(addr, n)
+			if err != nil {
+				return next, fmt.Errorf("Failed to read memory at %#x: %w", addr, err)
+			}
+			symbol := func(a uint64) string {
+				locs, err := c.FindLocation(scope, fmt.Sprintf("*%#x", a), false, nil)
+				if err != nil || len(locs) == 0 || locs[0].Function == nil {
+					return ""
+				}
+				return fmt.Sprintf("%s %s:%d", locs[0].Function.Name(), locs[0].File, locs[0].Line)
+			}
+			fmt.Fprintf(out, "%s", formatMemory(addr, mem, format, symbol))
+			return next, nil
+		}
+
+		if cmd == "Up" || cmd == "Down" || strings.HasPrefix(cmd, "Frame ") {
+			st, err := stopped()
+			if err != nil {
+				return next, err
+			}
+			n := sess.Scope(st).Frame
+			switch cmd {
+			case "Up":
+				n++
+			case "Down":
+				n--
+			default:
+				arg := strings.TrimSpace(strings.TrimPrefix(cmd, "Frame "))
+				n, err = strconv.Atoi(arg)
+				if err != nil {
+					return next, fmt.Errorf("Expected a frame number, but found \"%v\": %w", arg, err)
+				}
+			}
+			if n < 0 {
+				return next, fmt.Errorf("Already at the bottom of the stack.")
+			}
+			frames, err := c.Stacktrace(goroutineID(st), n, 0, nil)
+			if err != nil {
+				return next, fmt.Errorf("Failed to get stacktrace: %w", err)
+			}
+			if n >= len(frames) {
+				return next, fmt.Errorf("No frame %d. The stack has %d frames.", n, len(frames))
+			}
+			sess.setFrame(n)
+			fr := frames[n]
+			fmt.Fprintf(out, "Frame %d: %s:%d %s\n", n, fr.File, fr.Line, fr.Function.Name())
+			err = acmetools.PlumbCmd(dir, fmt.Sprintf("%s:%d", fr.File, fr.Line))
+			if err != nil {
+				fmt.Fprintf(body, "Failed to plumb: %v\n", err)
+			}
+			printLocals(sess.Scope(st))
+			aux.Refresh("stack")
+			aux.Refresh("disasm")
+			aux.Refresh("regs")
+			return next, nil
 		}
 
+		return next, fmt.Errorf("Unknown command %s", cmd)
+	}
+
+	// runRequest runs a command sent to the session, and replies with what it printed.
+	runRequest := func(next <-chan *api.DebuggerState, req *Request) <-chan *api.DebuggerState {
+		var msg bytes.Buffer
+		next, err := handleCommand(next, req.Cmd, io.MultiWriter(body, &msg))
+		if err != nil {
+			fmt.Fprintf(body, "%v\n", err)
+		}
+		req.Done(strings.TrimSpace(msg.String()), err)
 		return next
 	}
 
@@ -484,22 +1335,46 @@ func RunDlvWin(a *acmetools.Acme, dir string, cmds <-chan string) {
 			e.S = nexte.S
 			fmt.Printf("FinalEvent: [%+v]\n", e)
 		}
+		confirmDel.Event(e)
 		fmt.Printf("FinalEvent2: [%#v]\n", e)
 		fmt.Printf("FLAG: %v\n", e.Flag)
+		handled, err := body.HandleEvent(e)
+		if err != nil {
+			fmt.Fprintf(body, "%s: %v\n", e.S, err)
+		}
+		if handled {
+			return next
+		}
 		if e.IsBuiltin() {
+			if isDel(e) && ownTarget {
+				st, err := c.GetStateNonBlocking()
+				// Delete, like acme's own, doesn't ask.
+				if !confirmDel.Del(err == nil && st.Running) {
+					fmt.Fprintf(body, "The target is running. Del again to kill it, or Detach to leave it running.\n")
+					return next
+				}
+			}
 			fmt.Printf("Writing Back.\n")
 			es.WriteBack(e)
 			return next
 		}
 
 		if e.Type == acmetools.ET_BodyBtn2 || e.Type == acmetools.ET_TagBtn2 {
-			return handleCommand(next, e.S)
+			next, err := handleCommand(next, e.S, body)
+			if err != nil {
+				fmt.Fprintf(body, "%v\n", err)
+			}
+			return next
 		}
 		return next
 	}
 
 	var next <-chan *api.DebuggerState
 	for {
+		if detached {
+			win.Ctl("delete")
+			return
+		}
 		if next != nil {
 			//fmt.Printf("Waiting on EVENT and NEXT too.\n")
 			select {
@@ -508,14 +1383,19 @@ func RunDlvWin(a *acmetools.Acme, dir string, cmds <-chan string) {
 					return
 				}
 				next = handleEvent(next, e)
-			case cmd, ok := <-cmds:
+			case req, ok := <-cmds:
 				if !ok {
 					a.Log("Command Channel closed. Exiting.\n")
 					return
 				}
-				next = handleCommand(next, cmd)
-			case s := <-next:
-				next = nil
+				next = runRequest(next, req)
+			case s, ok := <-next:
+				if !ok {
+					// Continue delivers a state for each tracepoint hit, and closes once the
+					// target stops for good.
+					next = nil
+					continue
+				}
 				handleDebuggerState(s)
 			}
 		} else {
@@ -526,24 +1406,17 @@ func RunDlvWin(a *acmetools.Acme, dir string, cmds <-chan string) {
 					return
 				}
 				next = handleEvent(next, e)
-			case cmd, ok := <-cmds:
+			case req, ok := <-cmds:
 				if !ok {
 					a.Log("Command Channel closed. Exiting.\n")
 					return
 				}
-				next = handleCommand(next, cmd)
+				next = runRequest(next, req)
 			}
 		}
 	}
 }
 
-var port int = 35800
-
-func genport() int {
-	port++
-	return port
-}
-
 func testRPC() {
 	c := rpc2.NewClient("localhost:8181")
 	// 	if err != nil {
@@ -563,42 +1436,50 @@ func testRPC() {
 	spew.Dump(state)
 }
 
-func LaunchTestDlv(dir string, stdout, stderr io.Writer) (int, error) {
-	port := genport()
-	c := exec.Command("dlv", "test", "--headless", "-l", fmt.Sprintf("127.0.0.1:%d", port))
-	c.Dir = dir
-	c.Stdout = stdout
-	c.Stderr = stderr
-	fmt.Printf("Starting: %v\n", c)
-	err := c.Start()
-	if err != nil {
-		return 0, err
+// describeConds describes the conditions of a breakpoint.
+func describeConds(bp *api.Breakpoint) string {
+	var conds []string
+	if bp.Cond != "" {
+		conds = append(conds, "if "+bp.Cond)
+	}
+	if bp.HitCond != "" {
+		conds = append(conds, "when hit count "+bp.HitCond)
+	}
+	if len(conds) == 0 {
+		return "unconditional"
 	}
-	time.Sleep(1 * time.Second)
-	return port, nil
+	return strings.Join(conds, ", ")
 }
 
-func getFileLine(a *acmetools.Acme) (string, int, error) {
+// currentWindow returns the acme window the command was run from, and the name of its file.
+func currentWindow(a *acmetools.Acme) (*acmetools.Window, string, error) {
 	winid := os.Getenv("winid")
 	if winid == "" {
-		return "", 0, fmt.Errorf("Could not find acme window. $winid not set.")
+		return nil, "", fmt.Errorf("Could not find acme window. $winid not set.")
 	}
 
 	w, err := a.GetWindow(winid)
 	if err != nil {
-		//fmt.Printf("FATAL: %s\n", err)
+		//fmt.Printf("FATAL: %s\n", err)
 		//os.Exit(1)
-		return "", 0, err
+		return nil, "", err
 	}
 
 	tag, err := w.Tag()
 	if err != nil {
 		//		fmt.Printf("FATAL: %s\n", err)
 		//		os.Exit(1)
-		return "", 0, err
+		return nil, "", err
 	}
 	parts := strings.SplitN(tag, " ", 2)
-	fname := parts[0]
+	return w, parts[0], nil
+}
+
+func getFileLine(a *acmetools.Acme) (string, int, error) {
+	w, fname, err := currentWindow(a)
+	if err != nil {
+		return "", 0, err
+	}
 	stat, err := os.Stat(fname)
 	if err != nil {
 		//		fmt.Printf("FATAL: %s: %s\n", fname, err)
@@ -628,33 +1509,73 @@ func getFileLine(a *acmetools.Acme) (string, int, error) {
 	return fname, lineStart, nil
 }
 
-func writeCommand(s string) error {
-	//fmt.Printf("WRITING COMMAND %v\n", s)
+// serviceOwner returns the user and group owning the service, from -user and -group or the
+// current user.
+func serviceOwner() (string, string, error) {
+	uname, group := *srvUser, *srvGroup
+	if uname != "" && group != "" {
+		return uname, group, nil
+	}
 	u, err := user.Current()
 	if err != nil {
-		return err
+		return "", "", err
+	}
+	if uname == "" {
+		uname = u.Username
+	}
+	if group == "" {
+		group = uname
+		if g, err := user.LookupGroupId(u.Gid); err == nil {
+			group = g.Name
+		}
+	}
+	return uname, group, nil
+}
+
+// call sends the command s to the running acme-dlv and waits for its reply. It returns what the
+// command printed about itself, or an error if it failed.
+func call(s string) (string, error) {
+	//fmt.Printf("WRITING COMMAND %v\n", s)
+	uname, _, err := serviceOwner()
+	if err != nil {
+		return "", err
 	}
 	ns, err := acmetools.Namespace()
 	if err != nil {
-		return fmt.Errorf("Can't locate namespace: %w", err)
+		return "", fmt.Errorf("Can't locate namespace: %w", err)
 	}
-	acmef, err := net.Dial("unix", path.Join(ns, "acme-dlv"))
+	acmef, err := net.Dial("unix", path.Join(ns, *srvName))
 	if err != nil {
-		return fmt.Errorf("Failed to dial acme-dlv: %w", err)
+		return "", fmt.Errorf("Failed to dial %s: %w", *srvName, err)
 	}
-	npc, err := client.NewClient(acmef, u.Username, "")
+	npc, err := client.NewClient(acmef, uname, "")
 	if err != nil {
-		return fmt.Errorf("Failed to attach to acme-dlv: %w", err)
+		return "", fmt.Errorf("Failed to attach to %s: %w", *srvName, err)
 	}
 	// TODO: add this when go9p adds Close to client
 	//defer npc.Close()
+	defer acmef.Close()
 
-	f, err := npc.Open("/cmd", proto.Owrite)
+	f, err := npc.Open("/rpc", proto.Ordwr)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer f.Close()
 	//fmt.Printf("WRITING [%s]\n", s)
-	fmt.Fprintf(f, "%s\n", s)
-	return nil
+	_, err = fmt.Fprintf(f, "%s\n", s)
+	if err != nil {
+		return "", err
+	}
+	reply, err := io.ReadAll(f)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read reply: %w", err)
+	}
+	status, msg, _ := strings.Cut(strings.TrimSpace(string(reply)), " ")
+	switch status {
+	case "ok":
+		return msg, nil
+	case "error":
+		return "", errors.New(msg)
+	}
+	return "", fmt.Errorf("Bad reply from acme-dlv: %q", reply)
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// A session's mode selects the dlv command used to start it.
+const (
+	ModeTest    = "test"    // dlv test [-- test flags]
+	ModeDebug   = "debug"   // dlv debug <pkg> [-- args]
+	ModeExec    = "exec"    // dlv exec <binary> [-- args]
+	ModeAttach  = "attach"  // dlv attach <pid>
+	ModeCore    = "core"    // dlv core <exe> <core>
+	ModeConnect = "connect" // connect to an already running headless dlv at <addr>
+)
+
+// SessionConfig describes how to start a debug session.
+type SessionConfig struct {
+	Mode string
+	Dir  string   // The directory dlv runs in.
+	Args []string // The mode's arguments, as given to New.
+}
+
+// ParseNew parses the arguments of a New command:
+//
+//	New <dir>
+//	New test <dir> [test flags...]
+//	New debug <dir> <pkg> [args...]
+//	New exec <dir> <binary> [args...]
+//	New attach <dir> <pid>
+//	New core <dir> <exe> <core>
+//	New connect <dir> <addr>
+//
+// The first form debugs the tests in dir.
+func ParseNew(arg string) (SessionConfig, error) {
+	args := splitArgs(arg)
+	if len(args) == 0 {
+		return SessionConfig{}, fmt.Errorf("New needs a directory.")
+	}
+	cfg := SessionConfig{Mode: ModeTest}
+	switch args[0] {
+	case ModeTest, ModeDebug, ModeExec, ModeAttach, ModeCore, ModeConnect:
+		cfg.Mode = args[0]
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return SessionConfig{}, fmt.Errorf("New %s needs a directory.", cfg.Mode)
+	}
+	cfg.Dir = args[0]
+	cfg.Args = args[1:]
+
+	fi, err := os.Stat(cfg.Dir)
+	if err != nil {
+		return SessionConfig{}, fmt.Errorf("Failed to find directory %s: %w", cfg.Dir, err)
+	}
+	if !fi.IsDir() {
+		return SessionConfig{}, fmt.Errorf("%s is not a directory.", cfg.Dir)
+	}
+
+	switch cfg.Mode {
+	case ModeDebug:
+		if len(cfg.Args) == 0 {
+			cfg.Args = []string{"."}
+		}
+	case ModeExec:
+		if len(cfg.Args) == 0 {
+			return SessionConfig{}, fmt.Errorf("New exec needs a binary.")
+		}
+	case ModeAttach:
+		if len(cfg.Args) != 1 {
+			return SessionConfig{}, fmt.Errorf("New attach needs a pid.")
+		}
+	case ModeCore:
+		if len(cfg.Args) != 2 {
+			return SessionConfig{}, fmt.Errorf("New core needs an executable and a core file.")
+		}
+	case ModeConnect:
+		if len(cfg.Args) != 1 {
+			return SessionConfig{}, fmt.Errorf("New connect needs an address.")
+		}
+	}
+	return cfg, nil
+}
+
+// String returns the New command that starts the session.
+func (cfg SessionConfig) String() string {
+	return fmt.Sprintf("New %s %s", cfg.Mode, joinArgs(append([]string{cfg.Dir}, cfg.Args...)))
+}
+
+// DlvArgs returns the arguments to dlv for the session, with the API server listening on addr. If
+// testOut is set, the tests of a ModeTest session report in test2json's format, on a standard
+// output redirected to testOut.
+func (cfg SessionConfig) DlvArgs(addr, testOut string) []string {
+	args := []string{cfg.Mode, "--headless", "-l", addr}
+	switch cfg.Mode {
+	case ModeTest:
+		testArgs := cfg.Args
+		if testOut != "" {
+			args = append(args, "-r", "stdout:"+testOut)
+			testArgs = append(testArgs[:len(testArgs):len(testArgs)], "-test.v=test2json")
+		}
+		if len(testArgs) > 0 {
+			args = append(args, "--")
+			args = append(args, testArgs...)
+		}
+	case ModeDebug, ModeExec:
+		args = append(args, cfg.Args[0])
+		if len(cfg.Args) > 1 {
+			args = append(args, "--")
+			args = append(args, cfg.Args[1:]...)
+		}
+	case ModeAttach, ModeCore:
+		args = append(args, cfg.Args...)
+	}
+	return args
+}
+
+// The lines of commands offered in a session window's tag. A mode offers those that make sense
+// for it.
+const (
+	tagRun     = "Restart Continue Stop Detach"
+	tagBreaks  = "Breaks\tDelBreak\tCond"
+	tagStep    = "Next\tStep\tStepOut\tStepInstruction"
+	tagInspect = "X\tWatches"
+	tagStack   = "Goroutines\tStack\tUp\tDown\tDisasm\tRegs"
+	tagTests   = "Tests\tRerunFailed"
+)
+
+// Tag returns the text added to the session window's tag, describing the session and offering the
+// commands that make sense for its mode.
+func (cfg SessionConfig) Tag() string {
+	var desc string
+	lines := []string{tagRun, tagBreaks, tagStep + "\t" + tagInspect, tagStack}
+	switch cfg.Mode {
+	case ModeDebug:
+		desc = fmt.Sprintf("Debugging %s", path.Join(cfg.Dir, cfg.Args[0]))
+	case ModeExec:
+		desc = fmt.Sprintf("Debugging %s", strings.Join(cfg.Args, " "))
+	case ModeAttach:
+		desc = fmt.Sprintf("Attached to %s", cfg.Args[0])
+		// A process we attached to can't be restarted.
+		lines[0] = strings.TrimPrefix(tagRun, "Restart ")
+	case ModeCore:
+		desc = fmt.Sprintf("Core %s %s", cfg.Args[0], cfg.Args[1])
+		// A core file can only be examined.
+		lines = []string{tagInspect, tagStack}
+	case ModeConnect:
+		desc = fmt.Sprintf("Connected to %s", cfg.Args[0])
+	default:
+		desc = fmt.Sprintf("Debugging Tests %s", cfg.Dir)
+		lines = append(lines, tagTests)
+	}
+	return fmt.Sprintf(" (%s)\n%s", desc, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseNew(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		in  string
+		cfg SessionConfig
+		err bool
+	}{
+		{
+			in:  dir,
+			cfg: SessionConfig{Mode: ModeTest, Dir: dir, Args: []string{}},
+		},
+		{
+			in:  "test " + dir + " -test.run TestFoo",
+			cfg: SessionConfig{Mode: ModeTest, Dir: dir, Args: []string{"-test.run", "TestFoo"}},
+		},
+		{
+			in:  "debug " + dir,
+			cfg: SessionConfig{Mode: ModeDebug, Dir: dir, Args: []string{"."}},
+		},
+		{
+			in:  "exec " + dir + " ./bin 'an arg'",
+			cfg: SessionConfig{Mode: ModeExec, Dir: dir, Args: []string{"./bin", "an arg"}},
+		},
+		{
+			in:  "attach " + dir + " 123",
+			cfg: SessionConfig{Mode: ModeAttach, Dir: dir, Args: []string{"123"}},
+		},
+		{
+			in:  "core " + dir + " exe core",
+			cfg: SessionConfig{Mode: ModeCore, Dir: dir, Args: []string{"exe", "core"}},
+		},
+		{
+			in:  "connect " + dir + " localhost:1234",
+			cfg: SessionConfig{Mode: ModeConnect, Dir: dir, Args: []string{"localhost:1234"}},
+		},
+		{in: "", err: true},
+		{in: "test", err: true},
+		{in: file, err: true},
+		{in: filepath.Join(dir, "missing"), err: true},
+		{in: "exec " + dir, err: true},
+		{in: "attach " + dir, err: true},
+		{in: "core " + dir + " exe", err: true},
+		{in: "connect " + dir, err: true},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			cfg, err := ParseNew(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Expected an error, but got %#v", cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, tt.cfg) {
+				t.Fatalf("Expected %#v, but got %#v", tt.cfg, cfg)
+			}
+			// String gives back a New command for the same session.
+			again, err := ParseNew(cfg.String()[len("New "):])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again, cfg) {
+				t.Fatalf("Expected %#v from %s, but got %#v", cfg, cfg, again)
+			}
+		})
+	}
+}
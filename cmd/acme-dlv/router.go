@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpc2"
+	"github.com/knusbaum/go9p/fs"
+)
+
+// A Request is a command for a session.
+type Request struct {
+	Cmd   string
+	Reply chan Reply // Receives the result of the command, if not nil. It must be buffered.
+}
+
+// Reply is the result of a command.
+type Reply struct {
+	Msg string // What the command printed about itself.
+	Err error
+}
+
+// Done sends the result of the request to its Reply channel, if it has one.
+func (req *Request) Done(msg string, err error) {
+	if req.Reply != nil {
+		req.Reply <- Reply{Msg: msg, Err: err}
+	}
+}
+
+// Session is a running debug session, as seen by the Router.
+type Session struct {
+	ID     int
+	Config SessionConfig
+	Root   string // The root of the module containing Config.Dir, or Config.Dir if there is none.
+	Name   string // The name of the session's window.
+	Cmds   chan *Request
+	Output *fs.DroppingStream // Everything written to the session's window.
+
+	mu     sync.Mutex
+	client *rpc2.RPCClient
+	frame  int // The frame of the current goroutine selected with Up, Down or Frame.
+}
+
+// Client returns the client connected to the session's dlv, or nil if it is not connected.
+func (s *Session) Client() *rpc2.RPCClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+func (s *Session) setClient(c *rpc2.RPCClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = c
+}
+
+// Scope returns the scope expressions are evaluated in while the target is stopped in st: the
+// selected frame of the current goroutine.
+func (s *Session) Scope(st *api.DebuggerState) api.EvalScope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return api.EvalScope{GoroutineID: goroutineID(st), Frame: s.frame}
+}
+
+func (s *Session) setFrame(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frame = n
+}
+
+// Router keeps track of the running debug sessions and sends each command to the session it
+// belongs to.
+type Router struct {
+	mu       sync.Mutex
+	nextID   int
+	sessions []*Session
+}
+
+// Add registers a new session for cfg.
+func (r *Router) Add(cfg SessionConfig) *Session {
+	if dir, err := filepath.Abs(cfg.Dir); err == nil {
+		cfg.Dir = dir
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	s := &Session{
+		ID:     r.nextID,
+		Config: cfg,
+		Root:   moduleRoot(cfg.Dir),
+		Name:   path.Join(cfg.Dir, "+dlv"),
+		Cmds:   make(chan *Request, 100),
+		Output: fs.NewDroppingStream(8192),
+	}
+	for _, o := range r.sessions {
+		if o.Name == s.Name {
+			s.Name = fmt.Sprintf("%s.%d", s.Name, s.ID)
+			break
+		}
+	}
+	r.sessions = append(r.sessions, s)
+	return s
+}
+
+// Remove unregisters a session once it has ended. Requests still queued for the session fail.
+func (r *Router) Remove(s *Session) {
+	r.mu.Lock()
+	for i, o := range r.sessions {
+		if o == s {
+			r.sessions = append(r.sessions[:i], r.sessions[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+	for {
+		select {
+		case req := <-s.Cmds:
+			req.Done("", fmt.Errorf("Session %s ended.", s.Name))
+		default:
+			return
+		}
+	}
+}
+
+// Route sends req to the session it belongs to.
+//
+// Commands about a file go to the session whose directory contains the file, or failing that, to
+// the session whose module contains it, if only one does. BreakFile, DelBreakFile and RunToCursor
+// name their file, and any other command can be sent about a file by prefixing it with "@<file> ".
+// Commands that are not about a file can only be routed when exactly one session is running.
+func (r *Router) Route(req *Request) error {
+	file, cmd := commandFile(req.Cmd)
+	req.Cmd = cmd
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, err := r.find(file)
+	if err != nil {
+		return err
+	}
+	select {
+	case s.Cmds <- req:
+		return nil
+	default:
+		return fmt.Errorf("Dropping command %s. Command queue for %s full.", cmd, s.Name)
+	}
+}
+
+// find returns the session for file. r.mu must be held.
+func (r *Router) find(file string) (*Session, error) {
+	if len(r.sessions) == 0 {
+		return nil, fmt.Errorf("No active debug session running. Please start one first.")
+	}
+	if file == "" {
+		if len(r.sessions) == 1 {
+			return r.sessions[0], nil
+		}
+		return nil, fmt.Errorf("%d debug sessions are running, and the command does not say which one it is for.", len(r.sessions))
+	}
+	var found *Session
+	for _, s := range r.sessions {
+		if within(s.Config.Dir, file) && (found == nil || len(s.Config.Dir) > len(found.Config.Dir)) {
+			found = s
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	n := 0
+	for _, s := range r.sessions {
+		if !within(s.Root, file) {
+			continue
+		}
+		switch {
+		case found == nil || len(s.Root) > len(found.Root):
+			found, n = s, 1
+		case len(s.Root) == len(found.Root):
+			n++
+		}
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("%s is ambiguous: it is in the module of %d debug sessions, but in none of their directories.", file, n)
+	}
+	if found != nil {
+		return found, nil
+	}
+	return nil, fmt.Errorf("No debug session is running for %s.", file)
+}
+
+// commandFile returns the file a command is about, if any, and the command to send to the
+// session.
+func commandFile(cmd string) (string, string) {
+	if strings.HasPrefix(cmd, "@") {
+		parts := strings.SplitN(cmd[1:], " ", 2)
+		if len(parts) == 2 {
+			return parts[0], strings.TrimSpace(parts[1])
+		}
+		return parts[0], ""
+	}
+	if strings.HasPrefix(cmd, "BreakFile ") || strings.HasPrefix(cmd, "DelBreakFile ") || strings.HasPrefix(cmd, "RunToCursor ") {
+		args := splitArgs(cmd)
+		if len(args) > 1 {
+			return args[1], cmd
+		}
+	}
+	return "", cmd
+}
+
+// within reports whether file is dir or is somewhere below it.
+func within(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// moduleRoot returns the nearest directory at or above dir holding a go.mod file, or dir if there
+// is none.
+func moduleRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		if d == filepath.Dir(d) {
+			return dir
+		}
+	}
+}
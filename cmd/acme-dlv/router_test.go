@@ -0,0 +1,122 @@
+package main
+
+import "testing"
+
+func TestCommandFile(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		file string
+		cmd  string
+	}{
+		{
+			in:   "Continue",
+			file: "",
+			cmd:  "Continue",
+		},
+		{
+			in:   "@/a/b.go X foo.bar",
+			file: "/a/b.go",
+			cmd:  "X foo.bar",
+		},
+		{
+			in:   "@/a/b.go",
+			file: "/a/b.go",
+			cmd:  "",
+		},
+		{
+			in:   "BreakFile /a/b.go 12 -c 'x > 1'",
+			file: "/a/b.go",
+			cmd:  "BreakFile /a/b.go 12 -c 'x > 1'",
+		},
+		{
+			in:   "DelBreakFile '/a/with space.go' 3",
+			file: "/a/with space.go",
+			cmd:  "DelBreakFile '/a/with space.go' 3",
+		},
+		{
+			in:   "RunToCursor /a/b.go 7",
+			file: "/a/b.go",
+			cmd:  "RunToCursor /a/b.go 7",
+		},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			file, cmd := commandFile(tt.in)
+			if file != tt.file || cmd != tt.cmd {
+				t.Fatalf("Expected (%q, %q), but got (%q, %q)", tt.file, tt.cmd, file, cmd)
+			}
+		})
+	}
+}
+
+func TestWithin(t *testing.T) {
+	for _, tt := range []struct {
+		dir    string
+		file   string
+		within bool
+	}{
+		{dir: "/a", file: "/a", within: true},
+		{dir: "/a", file: "/a/b.go", within: true},
+		{dir: "/a", file: "/a/b/c.go", within: true},
+		{dir: "/a", file: "/ab/c.go", within: false},
+		{dir: "/a/b", file: "/a/c.go", within: false},
+		{dir: "/a", file: "/a/../b.go", within: false},
+		{dir: "/a", file: "/a/..b/c.go", within: true},
+	} {
+		t.Run(tt.dir+" "+tt.file, func(t *testing.T) {
+			if within(tt.dir, tt.file) != tt.within {
+				t.Fatalf("Expected %v, but got %v", tt.within, !tt.within)
+			}
+		})
+	}
+}
+
+func TestRouterFind(t *testing.T) {
+	client := &Session{ID: 1, Config: SessionConfig{Dir: "/m/cmd/client"}, Root: "/m"}
+	server := &Session{ID: 2, Config: SessionConfig{Dir: "/m/cmd/server"}, Root: "/m"}
+	lib := &Session{ID: 3, Config: SessionConfig{Dir: "/m/lib"}, Root: "/m"}
+	other := &Session{ID: 4, Config: SessionConfig{Dir: "/o"}, Root: "/o"}
+	tool := &Session{ID: 5, Config: SessionConfig{Dir: "/p/cmd/tool"}, Root: "/p"}
+	r := &Router{sessions: []*Session{client, server, lib, other, tool}}
+
+	for _, tt := range []struct {
+		file string
+		want *Session
+	}{
+		{file: "/m/cmd/client/main.go", want: client},
+		{file: "/m/cmd/server/x/y.go", want: server},
+		{file: "/m/lib/lib.go", want: lib},
+		{file: "/o/o.go", want: other},
+		// Outside every session's directory, but in the module of several: ambiguous.
+		{file: "/m/util/util.go", want: nil},
+		// Outside the session's directory, but in the module of only that one.
+		{file: "/p/util/util.go", want: tool},
+		{file: "/elsewhere/x.go", want: nil},
+		{file: "", want: nil},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			s, err := r.find(tt.file)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("Expected an error, but got session %d", s.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tt.want {
+				t.Fatalf("Expected session %d, but got session %d", tt.want.ID, s.ID)
+			}
+		})
+	}
+
+	// A command that isn't about a file goes to the only session.
+	r = &Router{sessions: []*Session{other}}
+	if s, err := r.find(""); err != nil || s != other {
+		t.Fatalf("Expected the only session, but got %v, %v", s, err)
+	}
+	r = &Router{}
+	if _, err := r.find("/o/o.go"); err == nil {
+		t.Fatalf("Expected an error with no sessions")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpc2"
+	"github.com/knusbaum/go9p/fs"
+	"github.com/knusbaum/go9p/proto"
+)
+
+// fileLoad is how much of each variable is loaded for the locals file.
+var fileLoad = api.LoadConfig{
+	FollowPointers:     false,
+	MaxVariableRecurse: 0,
+	MaxStringLen:       64,
+	MaxArrayValues:     10,
+	MaxStructFields:    -1,
+}
+
+// AddSession serves s as the directory sessions/<ID>:
+//
+//	state        stopped or running, and where the target is stopped
+//	breakpoints  one breakpoint per line: id file:line function
+//	goroutines   one goroutine per line: id file:line function
+//	stack        the current goroutine's stack, one frame per line: n file:line function
+//	locals       the arguments and local variables of the selected frame: name = value
+//	ctl          each line written is run as a command, as though clicked in the window
+//	output       a stream of everything written to the window
+//
+// Reading state, breakpoints, goroutines, stack or locals returns the data as it is when the file
+// is opened. While the target is running, they only say so.
+func (srv *AcmeSrv) AddSession(s *Session) error {
+	stat := func(name string, mode uint32) *proto.Stat {
+		return srv.fs.NewStat(name, srv.user, srv.group, mode)
+	}
+	dir := fs.NewStaticDir(stat(strconv.Itoa(s.ID), 0550|proto.DMDIR))
+	dir.AddChild(fs.NewDynamicFile(stat("state", 0440), s.stateFile))
+	dir.AddChild(fs.NewDynamicFile(stat("breakpoints", 0440), s.breakpointsFile))
+	dir.AddChild(fs.NewDynamicFile(stat("goroutines", 0440), s.goroutinesFile))
+	dir.AddChild(fs.NewDynamicFile(stat("stack", 0440), s.stackFile))
+	dir.AddChild(fs.NewDynamicFile(stat("locals", 0440), s.localsFile))
+	dir.AddChild(&fs.WrappedFile{
+		File: fs.NewBaseFile(stat("ctl", 0220)),
+		WriteF: func(fid uint64, offset uint64, data []byte) (uint32, error) {
+			for _, cmd := range strings.Split(string(data), "\n") {
+				cmd = strings.TrimSpace(cmd)
+				if cmd == "" {
+					continue
+				}
+				select {
+				case s.Cmds <- &Request{Cmd: cmd}:
+				default:
+					return 0, fmt.Errorf("Command queue for %s full.", s.Name)
+				}
+			}
+			return uint32(len(data)), nil
+		},
+	})
+	dir.AddChild(fs.NewStreamFile(stat("output", 0440), s.Output))
+	return srv.sessions.AddChild(dir)
+}
+
+// RemoveSession stops serving s.
+func (srv *AcmeSrv) RemoveSession(s *Session) {
+	srv.sessions.DeleteChild(strconv.Itoa(s.ID))
+	s.Output.Close()
+}
+
+// stopped returns the session's client and the target's state if the target is stopped.
+// Otherwise it returns a line saying why it can't be inspected.
+func (s *Session) stopped() (*rpc2.RPCClient, *api.DebuggerState, string) {
+	c := s.Client()
+	if c == nil {
+		return nil, nil, "not connected\n"
+	}
+	st, err := c.GetStateNonBlocking()
+	if err != nil {
+		return nil, nil, fmt.Sprintf("error %v\n", err)
+	}
+	if st.Running {
+		return nil, nil, "running\n"
+	}
+	if st.Exited {
+		return nil, nil, fmt.Sprintf("exited %d\n", st.ExitStatus)
+	}
+	return c, st, ""
+}
+
+// goroutineID returns the goroutine commands and files refer to when st is current.
+func goroutineID(st *api.DebuggerState) int64 {
+	if st.SelectedGoroutine != nil {
+		return st.SelectedGoroutine.ID
+	}
+	if st.CurrentThread != nil {
+		return st.CurrentThread.GoroutineID
+	}
+	return -1
+}
+
+func (s *Session) stateFile() []byte {
+	_, st, msg := s.stopped()
+	if st == nil {
+		return []byte(msg)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "stopped\n")
+	fmt.Fprintf(&b, "goroutine %d\n", goroutineID(st))
+	if th := st.CurrentThread; th != nil {
+		fmt.Fprintf(&b, "thread %d\n", th.ID)
+		fmt.Fprintf(&b, "pc %#x\n", th.PC)
+		if th.Function != nil {
+			fmt.Fprintf(&b, "function %s\n", th.Function.Name())
+		}
+		fmt.Fprintf(&b, "location %s:%d\n", th.File, th.Line)
+		if th.Breakpoint != nil {
+			fmt.Fprintf(&b, "breakpoint %d\n", th.Breakpoint.ID)
+		}
+	}
+	return b.Bytes()
+}
+
+func (s *Session) breakpointsFile() []byte {
+	c, _, msg := s.stopped()
+	if c == nil {
+		return []byte(msg)
+	}
+	bps, err := c.ListBreakpoints(false)
+	if err != nil {
+		return []byte(fmt.Sprintf("error %v\n", err))
+	}
+	var b bytes.Buffer
+	for _, bp := range bps {
+		fmt.Fprintf(&b, "%d %s:%d %s\n", bp.ID, bp.File, bp.Line, bp.FunctionName)
+	}
+	return b.Bytes()
+}
+
+func (s *Session) goroutinesFile() []byte {
+	c, _, msg := s.stopped()
+	if c == nil {
+		return []byte(msg)
+	}
+	gs, _, err := c.ListGoroutines(0, 0)
+	if err != nil {
+		return []byte(fmt.Sprintf("error %v\n", err))
+	}
+	var b bytes.Buffer
+	for _, g := range gs {
+		loc := g.UserCurrentLoc
+		fmt.Fprintf(&b, "%d %s:%d %s\n", g.ID, loc.File, loc.Line, loc.Function.Name())
+	}
+	return b.Bytes()
+}
+
+func (s *Session) stackFile() []byte {
+	c, st, msg := s.stopped()
+	if c == nil {
+		return []byte(msg)
+	}
+	frames, err := c.Stacktrace(goroutineID(st), 100, 0, nil)
+	if err != nil {
+		return []byte(fmt.Sprintf("error %v\n", err))
+	}
+	var b bytes.Buffer
+	for i, fr := range frames {
+		fmt.Fprintf(&b, "%d %s:%d %s\n", i, fr.File, fr.Line, fr.Function.Name())
+	}
+	return b.Bytes()
+}
+
+func (s *Session) localsFile() []byte {
+	c, st, msg := s.stopped()
+	if c == nil {
+		return []byte(msg)
+	}
+	scope := s.Scope(st)
+	args, err := c.ListFunctionArgs(scope, fileLoad)
+	if err != nil {
+		return []byte(fmt.Sprintf("error %v\n", err))
+	}
+	locals, err := c.ListLocalVariables(scope, fileLoad)
+	if err != nil {
+		return []byte(fmt.Sprintf("error %v\n", err))
+	}
+	var b bytes.Buffer
+	for _, v := range append(args, locals...) {
+		fmt.Fprintf(&b, "%s = %s\n", v.Name, v.SinglelineString())
+	}
+	return b.Bytes()
+}
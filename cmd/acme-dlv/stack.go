@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// stackDepth is how many frames of a stack are listed.
+const stackDepth = 100
+
+// formatStack lists frames, one per line:
+//
+//	n file:line function
+//
+// The line of the frame cur is marked with '*'.
+func formatStack(goroutine int64, frames []api.Stackframe, cur int) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Goroutine %d\n\n", goroutine)
+	for i, fr := range frames {
+		mark := " "
+		if i == cur {
+			mark = "*"
+		}
+		fmt.Fprintf(&b, "%s %d\t%s:%d %s\n", mark, i, fr.File, fr.Line, fr.Function.Name())
+		if fr.Err != "" {
+			fmt.Fprintf(&b, "\t\t%s\n", fr.Err)
+		}
+	}
+	if len(frames) > stackDepth {
+		fmt.Fprintf(&b, "...\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/knusbaum/acmetools"
+)
+
+var testNameRE = regexp.MustCompile(`^Test\w*(/\S+)?$`)
+
+// testAtCursor finds the test to run from the current acme window, returning the directory of the
+// file and the names of the test and any subtests. If the selection is a test name, such as
+// TestFoo or TestFoo/bar, it is used. Otherwise the test is the function TestXxx enclosing the
+// cursor, and the subtests are the t.Run calls enclosing the cursor within it.
+func testAtCursor(a *acmetools.Acme) (string, []string, error) {
+	w, fname, err := currentWindow(a)
+	if err != nil {
+		return "", nil, err
+	}
+	sel, err := w.Selected()
+	if err != nil {
+		return "", nil, err
+	}
+	sel = strings.TrimSpace(sel)
+	if testNameRE.MatchString(sel) {
+		return path.Dir(fname), strings.Split(sel, "/"), nil
+	}
+
+	_, line, err := getFileLine(a)
+	if err != nil {
+		return "", nil, err
+	}
+	names, err := enclosingTest(fname, line)
+	if err != nil {
+		return "", nil, err
+	}
+	return path.Dir(fname), names, nil
+}
+
+// enclosingTest parses the Go file fname and returns the name of the test function containing
+// line, followed by the names of the subtests started with t.Run that contain it.
+func enclosingTest(fname string, line int) ([]string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fname, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	contains := func(n ast.Node) bool {
+		return fset.Position(n.Pos()).Line <= line && line <= fset.Position(n.End()).Line
+	}
+	for _, d := range f.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok || fd.Recv != nil || fd.Body == nil || !strings.HasPrefix(fd.Name.Name, "Test") || !contains(fd) {
+			continue
+		}
+		names := []string{fd.Name.Name}
+		ast.Inspect(fd.Body, func(n ast.Node) bool {
+			if n == nil || !contains(n) {
+				return false
+			}
+			if name, ok := subtestName(n); ok {
+				names = append(names, name)
+			}
+			return true
+		})
+		return names, nil
+	}
+	return nil, fmt.Errorf("%s:%d is not in a test function.", fname, line)
+}
+
+// subtestName returns the name given to a call of the form x.Run("name", ...).
+func subtestName(n ast.Node) (string, bool) {
+	call, ok := n.(*ast.CallExpr)
+	if !ok || len(call.Args) != 2 {
+		return "", false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Run" {
+		return "", false
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	name, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// testRunPattern returns a -test.run pattern matching exactly the test and subtests in names.
+func testRunPattern(names []string) string {
+	parts := make([]string, len(names))
+	for i, n := range names {
+		// The testing package replaces spaces in subtest names with underscores.
+		n = strings.ReplaceAll(n, " ", "_")
+		parts[i] = "^" + regexp.QuoteMeta(n) + "$"
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const enclosingTestSrc = `package foo
+
+import "testing"
+
+func helper() {}
+
+func TestFoo(t *testing.T) {
+	t.Run("first case", func(t *testing.T) {
+		t.Run("inner", func(t *testing.T) {
+			helper()
+		})
+	})
+	t.Run("second", func(t *testing.T) {
+	})
+	helper()
+}
+`
+
+func TestEnclosingTest(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "foo_test.go")
+	if err := os.WriteFile(fname, []byte(enclosingTestSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		line  int
+		names []string
+	}{
+		{line: 5, names: nil},
+		{line: 7, names: []string{"TestFoo"}},
+		{line: 8, names: []string{"TestFoo", "first case"}},
+		{line: 10, names: []string{"TestFoo", "first case", "inner"}},
+		{line: 13, names: []string{"TestFoo", "second"}},
+		{line: 15, names: []string{"TestFoo"}},
+	} {
+		names, err := enclosingTest(fname, tt.line)
+		if tt.names == nil {
+			if err == nil {
+				t.Errorf("Expected an error for line %d, but got %q", tt.line, names)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Line %d: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("Expected %q for line %d, but got %q", tt.names, tt.line, names)
+		}
+	}
+}
+
+func TestTestRunPattern(t *testing.T) {
+	for _, tt := range []struct {
+		names []string
+		out   string
+	}{
+		{
+			names: []string{"TestFoo"},
+			out:   "^TestFoo$",
+		},
+		{
+			names: []string{"TestFoo", "first case", "inner"},
+			out:   "^TestFoo$/^first_case$/^inner$",
+		},
+		{
+			names: []string{"TestFoo", "a.b(c)"},
+			out:   `^TestFoo$/^a\.b\(c\)$`,
+		},
+	} {
+		t.Run(tt.out, func(t *testing.T) {
+			if out := testRunPattern(tt.names); out != tt.out {
+				t.Fatalf("Expected %s, but got %s", tt.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// testEvent is an event of go test -json, as test2json makes it.
+type testEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// testResult is the outcome of one test: its last action, and what it printed.
+type testResult struct {
+	name    string
+	action  string // run, pass, fail or skip.
+	elapsed float64
+	output  []string
+}
+
+// failureRE matches the location at the start of a line a test logged, such as "foo_test.go:12:".
+var failureRE = regexp.MustCompile(`^\s*([\w./-]+\.go:\d+):`)
+
+// testResults collects the results of the tests of a ModeTest session. The test binary is run
+// with -test.v=test2json and its standard output, sent by dlv to a fifo, is converted to events by
+// go tool test2json. What the tests print goes to the session's window as it always has, without
+// the test framework's own lines, and the results are kept apart to show in their own window.
+type testResults struct {
+	dir  string // The package directory, which the locations tests log are relative to.
+	fifo string // The fifo dlv sends the test binary's standard output to.
+
+	f   *os.File
+	cmd *exec.Cmd
+
+	mu    sync.Mutex
+	order []string
+	tests map[string]*testResult
+}
+
+// startTestResults makes the fifo for the tests of the package in dir and starts test2json on it.
+// The program's output is written to out, and changed is called each time a test finishes.
+func startTestResults(dir string, out io.Writer, changed func()) (*testResults, error) {
+	tmp, err := os.MkdirTemp("", "acme-dlv")
+	if err != nil {
+		return nil, err
+	}
+	tr := &testResults{dir: dir, fifo: filepath.Join(tmp, "stdout"), tests: make(map[string]*testResult)}
+	err = syscall.Mkfifo(tr.fifo, 0600)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, fmt.Errorf("Failed to make fifo for test output: %w", err)
+	}
+	// The fifo is opened for writing too, so it neither blocks here until dlv opens it nor
+	// reaches EOF when a restart makes dlv open it again.
+	tr.f, err = os.OpenFile(tr.fifo, os.O_RDWR, 0)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, fmt.Errorf("Failed to open fifo for test output: %w", err)
+	}
+	tr.cmd = exec.Command("go", "tool", "test2json", "-t", "-p", dir)
+	tr.cmd.Dir = dir
+	tr.cmd.Stdin = tr.f
+	tr.cmd.Stderr = out
+	// go tool runs test2json as a child of its own, so they are killed together as a group.
+	tr.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	events, err := tr.cmd.StdoutPipe()
+	if err != nil {
+		tr.Close()
+		return nil, err
+	}
+	err = tr.cmd.Start()
+	if err != nil {
+		tr.cmd = nil
+		tr.Close()
+		return nil, fmt.Errorf("Failed to start test2json: %w", err)
+	}
+	go tr.read(events, out, changed)
+	return tr, nil
+}
+
+// read reads the events from test2json until it exits.
+func (tr *testResults) read(r io.Reader, out io.Writer, changed func()) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		var e testEvent
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			fmt.Fprintf(out, "%s\n", s.Bytes())
+			continue
+		}
+		if e.Action == "output" && !frameworkLine(e.Output) {
+			io.WriteString(out, e.Output)
+		}
+		if e.Test == "" {
+			continue
+		}
+		if tr.record(e) {
+			changed()
+		}
+	}
+}
+
+// frameworkLine reports whether line was printed by the testing package about the tests, rather
+// than by the tests.
+func frameworkLine(line string) bool {
+	for _, p := range []string{"=== RUN", "=== PAUSE", "=== CONT", "=== NAME", "--- PASS", "--- FAIL", "--- SKIP"} {
+		if strings.HasPrefix(strings.TrimSpace(line), p) {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds e to the results, and reports whether it finished a test.
+func (tr *testResults) record(e testEvent) bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	t, ok := tr.tests[e.Test]
+	if !ok || e.Action == "run" {
+		if !ok {
+			tr.order = append(tr.order, e.Test)
+		}
+		t = &testResult{name: e.Test, action: "run"}
+		tr.tests[e.Test] = t
+	}
+	switch e.Action {
+	case "output":
+		if !frameworkLine(e.Output) {
+			t.output = append(t.output, strings.TrimRight(e.Output, "\n"))
+		}
+	case "pass", "fail", "skip":
+		t.action = e.Action
+		t.elapsed = e.Elapsed
+		return true
+	}
+	return false
+}
+
+// Failed returns the names of the top level tests that failed.
+func (tr *testResults) Failed() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	var names []string
+	for _, name := range tr.order {
+		if t := tr.tests[name]; t.action == "fail" && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// String lists the tests, one per line, in the order they started:
+//
+//	PASS name (elapsed)
+//
+// Each failed test is followed by what it logged, with the locations made absolute so they can be
+// plumbed.
+func (tr *testResults) String() string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	var b bytes.Buffer
+	counts := make(map[string]int)
+	for _, name := range tr.order {
+		t := tr.tests[name]
+		counts[t.action]++
+		indent := strings.Repeat("    ", strings.Count(name, "/"))
+		if t.action == "run" {
+			fmt.Fprintf(&b, "%sRUN  %s\n", indent, name)
+			continue
+		}
+		fmt.Fprintf(&b, "%s%-4s %s (%.2fs)\n", indent, strings.ToUpper(t.action), name, t.elapsed)
+		if t.action != "fail" {
+			continue
+		}
+		for _, line := range t.output {
+			if m := failureRE.FindStringSubmatchIndex(line); m != nil {
+				loc := line[m[2]:m[3]]
+				if !filepath.IsAbs(loc) {
+					loc = filepath.Join(tr.dir, loc)
+				}
+				line = line[:m[2]] + loc + line[m[3]:]
+			}
+			fmt.Fprintf(&b, "%s\t%s\n", indent, strings.TrimSpace(line))
+		}
+	}
+	return fmt.Sprintf("%d passed, %d failed, %d skipped, %d running\n\n%s",
+		counts["pass"], counts["fail"], counts["skip"], counts["run"], b.String())
+}
+
+// Reset forgets the results, before the tests run again.
+func (tr *testResults) Reset() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.order = nil
+	tr.tests = make(map[string]*testResult)
+}
+
+// Close stops test2json and removes the fifo.
+func (tr *testResults) Close() {
+	if tr.cmd != nil {
+		syscall.Kill(-tr.cmd.Process.Pid, syscall.SIGKILL)
+		tr.cmd.Wait()
+	}
+	tr.f.Close()
+	os.RemoveAll(filepath.Dir(tr.fifo))
+}
+
+// failedRunPattern returns a -test.run pattern matching exactly the top level tests in names.
+func failedRunPattern(names []string) string {
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = regexp.QuoteMeta(n)
+	}
+	return "^(" + strings.Join(parts, "|") + ")$"
+}
+
+// withoutRunFlag returns the test flags args without any -test.run or -run flag.
+func withoutRunFlag(args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-test.run" || a == "-run" || a == "--test.run" || a == "--run":
+			i++
+		case strings.HasPrefix(a, "-test.run=") || strings.HasPrefix(a, "-run=") ||
+			strings.HasPrefix(a, "--test.run=") || strings.HasPrefix(a, "--run="):
+		default:
+			out = append(out, a)
+		}
+	}
+	return out
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFrameworkLine(t *testing.T) {
+	for _, tt := range []struct {
+		line      string
+		framework bool
+	}{
+		{line: "=== RUN   TestA\n", framework: true},
+		{line: "=== PAUSE TestA\n", framework: true},
+		{line: "=== CONT  TestA\n", framework: true},
+		{line: "=== NAME  TestA\n", framework: true},
+		{line: "--- PASS: TestA (0.00s)\n", framework: true},
+		{line: "    --- FAIL: TestA/sub (0.01s)\n", framework: true},
+		{line: "--- SKIP: TestA (0.00s)\n", framework: true},
+		{line: "    a_test.go:12: want 1\n", framework: false},
+		{line: "hello --- PASS\n", framework: false},
+		{line: "\n", framework: false},
+	} {
+		t.Run(tt.line, func(t *testing.T) {
+			if framework := frameworkLine(tt.line); framework != tt.framework {
+				t.Fatalf("Expected %v, but got %v", tt.framework, framework)
+			}
+		})
+	}
+}
+
+func TestFailedRunPattern(t *testing.T) {
+	for _, tt := range []struct {
+		names   []string
+		pattern string
+		match   []string
+		nomatch []string
+	}{
+		{
+			names:   []string{"TestA"},
+			pattern: "^(TestA)$",
+			match:   []string{"TestA"},
+			nomatch: []string{"TestAB", "XTestA"},
+		},
+		{
+			names:   []string{"TestA", "TestB"},
+			pattern: "^(TestA|TestB)$",
+			match:   []string{"TestA", "TestB"},
+			nomatch: []string{"TestC", "TestATestB"},
+		},
+		{
+			names:   []string{"Test.x+", "Test(1)|[2]"},
+			pattern: `^(Test\.x\+|Test\(1\)\|\[2\])$`,
+			match:   []string{"Test.x+", "Test(1)|[2]"},
+			nomatch: []string{"TestAxx", "Test1", "[2]"},
+		},
+	} {
+		t.Run(strings.Join(tt.names, " "), func(t *testing.T) {
+			pattern := failedRunPattern(tt.names)
+			if pattern != tt.pattern {
+				t.Fatalf("Expected %s, but got %s", tt.pattern, pattern)
+			}
+			re := regexp.MustCompile(pattern)
+			for _, s := range tt.match {
+				if !re.MatchString(s) {
+					t.Fatalf("Expected %s to match %s", pattern, s)
+				}
+			}
+			for _, s := range tt.nomatch {
+				if re.MatchString(s) {
+					t.Fatalf("Expected %s not to match %s", pattern, s)
+				}
+			}
+		})
+	}
+}
+
+func TestWithoutRunFlag(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{args: nil, want: nil},
+		{args: []string{"-test.v", "-test.count=1"}, want: []string{"-test.v", "-test.count=1"}},
+		{args: []string{"-test.run=TestA", "-test.v"}, want: []string{"-test.v"}},
+		{args: []string{"-test.run", "TestA", "-test.v"}, want: []string{"-test.v"}},
+		{args: []string{"-test.v", "-test.run", "^(TestA|TestB)$"}, want: []string{"-test.v"}},
+		{args: []string{"-run=X", "--test.run=Y", "--run", "Z", "-test.short"}, want: []string{"-test.short"}},
+		{args: []string{"-test.runx=1", "-test.bench", "."}, want: []string{"-test.runx=1", "-test.bench", "."}},
+		{args: []string{"-test.run"}, want: nil},
+	} {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			got := withoutRunFlag(tt.args)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Expected %q, but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTestResults(t *testing.T) {
+	tr := &testResults{dir: "/m/pkg", tests: make(map[string]*testResult)}
+	for _, tt := range []struct {
+		e        testEvent
+		finished bool
+	}{
+		{e: testEvent{Action: "run", Test: "TestA"}},
+		{e: testEvent{Action: "output", Test: "TestA", Output: "=== RUN   TestA\n"}},
+		{e: testEvent{Action: "run", Test: "TestA/x.y*"}},
+		{e: testEvent{Action: "output", Test: "TestA/x.y*", Output: "    a_test.go:12: want 1\n"}},
+		{e: testEvent{Action: "fail", Test: "TestA/x.y*", Elapsed: 0.01}, finished: true},
+		{e: testEvent{Action: "fail", Test: "TestA", Elapsed: 0.02}, finished: true},
+		{e: testEvent{Action: "run", Test: "TestB"}},
+		{e: testEvent{Action: "pass", Test: "TestB"}, finished: true},
+		{e: testEvent{Action: "run", Test: "Test(C)"}},
+		{e: testEvent{Action: "output", Test: "Test(C)", Output: "/abs/c_test.go:3: bad\n"}},
+		{e: testEvent{Action: "fail", Test: "Test(C)", Elapsed: 1}, finished: true},
+		{e: testEvent{Action: "run", Test: "TestD"}},
+		{e: testEvent{Action: "skip", Test: "TestD"}, finished: true},
+		{e: testEvent{Action: "run", Test: "TestE"}},
+	} {
+		if finished := tr.record(tt.e); finished != tt.finished {
+			t.Fatalf("Expected %v for %+v, but got %v", tt.finished, tt.e, finished)
+		}
+	}
+
+	// Only the top level tests are rerun, since a subtest runs only as part of its parent.
+	if failed, want := tr.Failed(), []string{"TestA", "Test(C)"}; !reflect.DeepEqual(failed, want) {
+		t.Fatalf("Expected %q, but got %q", want, failed)
+	}
+
+	want := `1 passed, 3 failed, 1 skipped, 1 running
+
+FAIL TestA (0.02s)
+    FAIL TestA/x.y* (0.01s)
+    	/m/pkg/a_test.go:12: want 1
+PASS TestB (0.00s)
+FAIL Test(C) (1.00s)
+	/abs/c_test.go:3: bad
+SKIP TestD (0.00s)
+RUN  TestE
+`
+	if s := tr.String(); s != want {
+		t.Fatalf("Expected %s, but got %s", want, s)
+	}
+
+	tr.Reset()
+	if s := tr.String(); s != "0 passed, 0 failed, 0 skipped, 0 running\n\n" {
+		t.Fatalf("Expected no results after Reset, but got %s", s)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpc2"
+)
+
+// watchList is a session's watch expressions, which are evaluated each time the target stops.
+type watchList struct {
+	next    int
+	watches []*watch
+}
+
+type watch struct {
+	n     int
+	expr  string
+	value string // The value when the list was last evaluated.
+	prev  string // The value before that, if it was different.
+}
+
+// Add adds expr to the list, and returns its number.
+func (wl *watchList) Add(expr string) int {
+	wl.next++
+	wl.watches = append(wl.watches, &watch{n: wl.next, expr: expr})
+	return wl.next
+}
+
+// Remove removes the expression numbered n, and reports whether there was one.
+func (wl *watchList) Remove(n int) bool {
+	for i, w := range wl.watches {
+		if w.n == n {
+			wl.watches = append(wl.watches[:i], wl.watches[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of expressions in the list.
+func (wl *watchList) Len() int {
+	return len(wl.watches)
+}
+
+// Eval evaluates each expression in scope, remembering the values that changed since the last
+// evaluation.
+func (wl *watchList) Eval(c *rpc2.RPCClient, scope api.EvalScope) {
+	for _, w := range wl.watches {
+		var value string
+		v, err := c.EvalVariable(scope, w.expr, fileLoad)
+		if err != nil {
+			value = fmt.Sprintf("<%v>", err)
+		} else if v.Unreadable != "" {
+			value = fmt.Sprintf("<%s>", v.Unreadable)
+		} else {
+			value = v.SinglelineString()
+		}
+		w.prev = ""
+		if w.value != "" && w.value != value {
+			w.prev = w.value
+		}
+		w.value = value
+	}
+}
+
+// String lists the expressions and their values, one per line. Values that changed at the last
+// evaluation are followed by what they were before.
+func (wl *watchList) String() string {
+	var b bytes.Buffer
+	for _, w := range wl.watches {
+		fmt.Fprintf(&b, "%d\t%s = %s", w.n, w.expr, w.value)
+		if w.prev != "" {
+			fmt.Fprintf(&b, "\t(was %s)", w.prev)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
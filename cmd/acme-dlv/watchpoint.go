@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpc2"
+)
+
+// parseWatchType parses the type of a watchpoint: r, w or rw. The default is w.
+func parseWatchType(s string) (api.WatchType, error) {
+	switch s {
+	case "", "w":
+		return api.WatchWrite, nil
+	case "r":
+		return api.WatchRead, nil
+	case "rw":
+		return api.WatchRead | api.WatchWrite, nil
+	}
+	return 0, fmt.Errorf("Unknown watchpoint type %s. Expected r, w or rw.", s)
+}
+
+// watchTypeString returns t as parseWatchType takes it.
+func watchTypeString(t api.WatchType) string {
+	s := ""
+	if t&api.WatchRead != 0 {
+		s += "r"
+	}
+	if t&api.WatchWrite != 0 {
+		s += "w"
+	}
+	return s
+}
+
+// watchpoints remembers what a session's watchpoints watch, so that when one fires its old value
+// can be shown next to its new one. dlv reports only that a watchpoint fired.
+type watchpoints map[int]*watchpoint
+
+type watchpoint struct {
+	expr  string
+	typ   string // The type of the watched variable.
+	addr  uint64 // The address of the watched variable.
+	value string // The value when the watchpoint last fired, or was set.
+}
+
+// Create sets a watchpoint on expr, which is evaluated in scope.
+func (wps watchpoints) Create(c *rpc2.RPCClient, scope api.EvalScope, expr string, t api.WatchType) (*api.Breakpoint, error) {
+	v, err := c.EvalVariable(scope, expr, fileLoad)
+	if err != nil {
+		return nil, err
+	}
+	bp, err := c.CreateWatchpoint(scope, expr, t)
+	if err != nil {
+		return nil, err
+	}
+	wps[bp.ID] = &watchpoint{expr: expr, typ: v.Type, addr: v.Addr, value: summary(v)}
+	return bp, nil
+}
+
+// Hit returns the value the watchpoint bp had when it last fired or was set, and the value it
+// has now.
+func (wps watchpoints) Hit(c *rpc2.RPCClient, scope api.EvalScope, bp *api.Breakpoint) (old, now string) {
+	wp, ok := wps[bp.ID]
+	if !ok {
+		return "?", "?"
+	}
+	// The watched variable may not be in scope where it is written, so it is read by address.
+	// Failing that, the expression is tried in the scope of the stop.
+	v, err := c.EvalVariable(scope, fmt.Sprintf("*(*%s)(%#x)", quoteTypePaths(wp.typ), wp.addr), fileLoad)
+	if err != nil {
+		var err2 error
+		v, err2 = c.EvalVariable(scope, wp.expr, fileLoad)
+		if err2 != nil {
+			return wp.value, fmt.Sprintf("<%v>", err)
+		}
+	}
+	old, wp.value = wp.value, summary(v)
+	return old, wp.value
+}
+
+// typePathRE matches a name qualified by a package path with a slash in it, such as
+// github.com/x/y.T. The name is the last dot-separated part, since paths may hold dots.
+var typePathRE = regexp.MustCompile(`((?:[\w.~-]+/)+[\w.~-]+)\.(\w+)`)
+
+// quoteTypePaths quotes the package paths in a type name as dlv writes it, such as
+// []*github.com/x/y.T, so that it can be used in an expression: []*"github.com/x/y".T.
+func quoteTypePaths(typ string) string {
+	return typePathRE.ReplaceAllString(typ, `"$1".$2`)
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestQuoteTypePaths(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		out string
+	}{
+		{in: "int", out: "int"},
+		{in: "main.T", out: "main.T"},
+		{in: "time.Time", out: "time.Time"},
+		{in: "github.com/x/y.T", out: `"github.com/x/y".T`},
+		{in: "*github.com/x/y.T", out: `*"github.com/x/y".T`},
+		{in: "[]gopkg.in/yaml.v2.Node", out: `[]"gopkg.in/yaml.v2".Node`},
+		{in: "map[string]net/http.Header", out: `map[string]"net/http".Header`},
+		{
+			in:  "github.com/x/y.G[github.com/a/b.C,int]",
+			out: `"github.com/x/y".G["github.com/a/b".C,int]`,
+		},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			if out := quoteTypePaths(tt.in); out != tt.out {
+				t.Fatalf("Expected %s, but got %s", tt.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/knusbaum/acmetools"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [command [args...]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "sh"
+		}
+		args = []string{shell, "-i"}
+	}
+
+	a, err := acmetools.NewAcme()
+	if err != nil {
+		log.Fatalf("Failed to connect to acme: %v", err)
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Failed to get working directory: %v", err)
+	}
+
+	w, err := a.NewWindow()
+	if err != nil {
+		log.Fatalf("Failed to create window: %v", err)
+	}
+	defer w.Close()
+	w.Ctl(fmt.Sprintf("name %s", path.Join(dir, "-"+path.Base(args[0]))))
+	w.Ctl(fmt.Sprintf("dumpdir %s", dir))
+	w.Ctl(fmt.Sprintf("dump %s", args[0]))
+	w.AppendTag(" Send Intr Eof Kill")
+
+	es, err := w.Events()
+	if err != nil {
+		log.Fatalf("Failed to get events stream: %v", err)
+	}
+	defer es.Close()
+
+	t, err := acmetools.NewTerm(w)
+	if err != nil {
+		log.Fatalf("Failed to open terminal: %v", err)
+	}
+	defer t.Close()
+
+	c := exec.Command(args[0], args[1:]...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "TERM=dumb", fmt.Sprintf("winid=%s", w.ID()))
+	err = t.Start(c)
+	if err != nil {
+		fmt.Fprintf(t, "Failed to start %s: %v\n", args[0], err)
+		return
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- t.Wait()
+	}()
+
+	for {
+		select {
+		case err := <-exited:
+			if err != nil {
+				fmt.Fprintf(t, "\n%s: %v\n", args[0], err)
+			}
+			w.Ctl("clean")
+			exited = nil
+		case e, ok := <-es.C:
+			if !ok {
+				return
+			}
+			if e.HasExpansion() {
+				nexte := <-es.C
+				e.NChars = nexte.NChars
+				e.S = nexte.S
+			}
+			// The argument and its origin aren't used.
+			es.SkipChord(e)
+			handled, err := t.HandleEvent(e)
+			if err != nil {
+				fmt.Fprintf(t, "%s: %v\n", e.S, err)
+			}
+			if handled {
+				continue
+			}
+			switch e.Type {
+			case acmetools.ET_BodyBtn2, acmetools.ET_TagBtn2:
+				if e.S == "Del" && exited != nil {
+					t.Kill()
+				}
+				es.WriteBack(e)
+			case acmetools.ET_BodyBtn3, acmetools.ET_TagBtn3:
+				es.WriteBack(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package acmetools
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+func TestEventText(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		wire string
+		ev   Event
+	}{
+		{
+			name: "delete",
+			wire: "KD10 12 0 0 \n",
+			ev:   Event{Origin: EV_Keyboard, Type: ET_BodyDelete, StartAddr: 10, EndAddr: 12},
+		},
+		{
+			name: "builtin",
+			wire: "Mx3 6 1 3 Del\n",
+			ev:   Event{Origin: EV_Mouse, Type: ET_TagBtn2, StartAddr: 3, EndAddr: 6, Flag: 1, NChars: 3, S: "Del"},
+		},
+		{
+			name: "multiline",
+			wire: "EI0 9 0 9 a\nb\n\tc\nλ→\n",
+			ev:   Event{Origin: EV_Write, Type: ET_BodyInsert, StartAddr: 0, EndAddr: 9, NChars: 9, S: "a\nb\n\tc\nλ→"},
+		},
+		{
+			name: "newline",
+			wire: "KI4 5 0 1 \n\n",
+			ev:   Event{Origin: EV_Keyboard, Type: ET_BodyInsert, StartAddr: 4, EndAddr: 5, NChars: 1, S: "\n"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var ev Event
+			if err := ev.UnmarshalText([]byte(tt.wire)); err != nil {
+				t.Fatal(err)
+			}
+			if ev != tt.ev {
+				t.Fatalf("Expected %#v, but got %#v", tt.ev, ev)
+			}
+			bs, err := ev.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(bs) != tt.wire {
+				t.Fatalf("Expected %q, but got %q", tt.wire, bs)
+			}
+
+			// An Event is encoded the same whether or not it is addressable.
+			for _, v := range []interface{}{&ev, ev, map[string]Event{"ev": ev}["ev"]} {
+				js, err := json.Marshal(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var jev Event
+				if err := json.Unmarshal(js, &jev); err != nil {
+					t.Fatalf("Failed to decode %s from %T: %v", js, v, err)
+				}
+				if jev != tt.ev {
+					t.Fatalf("Expected %#v from JSON of %T, but got %#v", tt.ev, v, jev)
+				}
+			}
+		})
+	}
+}
+
+func TestEventTextErrors(t *testing.T) {
+	for _, wire := range []string{
+		"",
+		"KD10 12 0 0 ",
+		"KD10 x 0 0 \n",
+		"KI4 5 0 3 ab\n",
+		"KI4 5 0 1 a\nextra",
+		"QQ1 2 0 0 \n",
+	} {
+		var ev Event
+		if err := ev.UnmarshalText([]byte(wire)); err == nil {
+			t.Errorf("Expected an error for %q, but got %#v", wire, ev)
+		}
+	}
+}
+
+func TestEventStreamWrite(t *testing.T) {
+	a, b := net.Pipe()
+	in := NewEventStream(a)
+	defer in.Close()
+	out := NewEventStream(b)
+	defer out.Close()
+
+	evs := []Event{
+		{Origin: EV_Mouse, Type: ET_BodyBtn3, StartAddr: 1, EndAddr: 20, Flag: 4, NChars: 18, S: "/tmp/foo.go:10\nbar"},
+		{Origin: EV_File, Type: ET_TagInsert, StartAddr: 0, EndAddr: 2, NChars: 2, S: "é "},
+	}
+	go func() {
+		for i := range evs {
+			if err := out.Write(&evs[i]); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for _, want := range evs {
+		got := <-in.C
+		if *got != want {
+			t.Fatalf("Expected %#v, but got %#v", want, *got)
+		}
+	}
+}
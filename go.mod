@@ -6,6 +6,7 @@ require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/go-delve/delve v1.9.1
 	github.com/knusbaum/go9p v0.23.0
+	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab
 )
 
 require (
@@ -19,6 +20,5 @@ require (
 	github.com/mattn/go-isatty v0.0.3 // indirect
 	github.com/sirupsen/logrus v1.6.0 // indirect
 	golang.org/x/arch v0.0.0-20190927153633-4e8777c89be4 // indirect
-	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,107 @@
+package acmetools
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyContext describes where a key was typed.
+type KeyContext struct {
+	Key        rune   // The key that was typed.
+	Addr       int    // The rune offset of the key in the body.
+	Prev       rune   // The rune before the key, or 0 if the key is at the start of the body.
+	LinePrefix string // The text of the line from its start up to the key.
+}
+
+// KeyEdit is an edit to make in response to a typed key. Text is inserted immediately after the
+// key, and the cursor is left Dot runes into Text.
+type KeyEdit struct {
+	Text string
+	Dot  int
+}
+
+// KeyHook is called when the key it was registered for is typed. If it returns true, the
+// returned KeyEdit is applied to the window.
+type KeyHook func(kc KeyContext) (KeyEdit, bool)
+
+// OnKey registers h to be called by HandleKey when key is typed into the body. Hooks for the same
+// key are tried in the order they were registered, and only the first one returning true is
+// applied.
+func (e *EventStream) OnKey(key rune, h KeyHook) {
+	if e.keys == nil {
+		e.keys = make(map[rune][]KeyHook)
+	}
+	e.keys[key] = append(e.keys[key], h)
+}
+
+// HandleKey runs the hooks registered with OnKey for a key typed into the body, and reports
+// whether one of them made an edit. Events that aren't a single key typed into the body are
+// ignored.
+//
+// Edits are written through the window's addr and data files, so they will also appear in the
+// stream as events with origin EV_File.
+func (e *EventStream) HandleKey(ev *Event) (bool, error) {
+	if ev.Origin != EV_Keyboard || ev.Type != ET_BodyInsert || ev.EndAddr-ev.StartAddr != 1 {
+		return false, nil
+	}
+	key, _ := utf8.DecodeRuneInString(ev.S)
+	hooks := e.keys[key]
+	if len(hooks) == 0 {
+		return false, nil
+	}
+	if e.w == nil {
+		return false, fmt.Errorf("Event stream has no window.")
+	}
+	kc, err := e.keyContext(key, ev.StartAddr)
+	if err != nil {
+		return false, err
+	}
+	for _, h := range hooks {
+		edit, ok := h(kc)
+		if !ok {
+			continue
+		}
+		if edit.Text != "" {
+			err = e.w.Replace(fmt.Sprintf("#%d", ev.EndAddr), edit.Text)
+			if err != nil {
+				return false, err
+			}
+		}
+		err = e.w.WriteAddr(fmt.Sprintf("#%d", ev.EndAddr+edit.Dot))
+		if err != nil {
+			return false, err
+		}
+		return true, e.w.Ctl("dot=addr")
+	}
+	return false, nil
+}
+
+// keyContext reads the line leading up to the key at addr, going back a chunk at a time until
+// the start of the line is found.
+func (e *EventStream) keyContext(key rune, addr int) (KeyContext, error) {
+	kc := KeyContext{Key: key, Addr: addr}
+	chunk := 256
+	for {
+		start := addr - chunk
+		if start < 0 {
+			start = 0
+		}
+		s, err := e.w.ReadAddr(fmt.Sprintf("#%d,#%d", start, addr))
+		if err != nil {
+			return KeyContext{}, err
+		}
+		if kc.Prev == 0 && s != "" {
+			kc.Prev, _ = utf8.DecodeLastRuneInString(s)
+		}
+		if i := strings.LastIndex(s, "\n"); i >= 0 {
+			kc.LinePrefix = s[i+1:]
+			return kc, nil
+		}
+		if start == 0 {
+			kc.LinePrefix = s
+			return kc, nil
+		}
+		chunk *= 2
+	}
+}
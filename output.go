@@ -0,0 +1,111 @@
+package acmetools
+
+import (
+	"fmt"
+	"sync"
+)
+
+// OutputWindow is a window used to display the output of a command. Everything written to an
+// OutputWindow is appended to the window's body, and the window is kept clean so that Del does
+// not complain about unsaved changes.
+type OutputWindow struct {
+	mu     sync.Mutex
+	w      *Window
+	follow bool
+}
+
+// OutputWindow returns an OutputWindow with the given name. If a window with that name is already
+// open it is reused, otherwise a new window is created and given the name.
+func (a *Acme) OutputWindow(name string) (*OutputWindow, error) {
+	w, err := a.LookupWindow(name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		w, err = a.NewWindow()
+		if err != nil {
+			return nil, err
+		}
+		err = w.Ctl(fmt.Sprintf("name %s", name))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = w.Ctl("clean")
+	if err != nil {
+		return nil, err
+	}
+	return &OutputWindow{w: w}, nil
+}
+
+// Window returns the underlying Window, which can be used to change the tag or read events.
+func (o *OutputWindow) Window() *Window {
+	return o.w
+}
+
+// Follow sets follow mode. While following, every write scrolls the window so the last line of
+// the body stays visible.
+func (o *OutputWindow) Follow(on bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.follow = on
+}
+
+// Write appends p to the window's body.
+func (o *OutputWindow) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	body, err := o.w.Body()
+	if err != nil {
+		return 0, err
+	}
+	n, err := body.Write(p)
+	if err != nil {
+		return n, err
+	}
+	err = o.w.Ctl("clean")
+	if err != nil {
+		return n, err
+	}
+	if o.follow {
+		err = o.show("$")
+	}
+	return n, err
+}
+
+// show sets dot to the address a and makes sure it is visible.
+func (o *OutputWindow) show(a string) error {
+	// Make sure addr is open
+	_, _, err := o.w.Addr()
+	if err != nil {
+		return err
+	}
+	err = o.w.WriteAddr(a)
+	if err != nil {
+		return err
+	}
+	err = o.w.Ctl("dot=addr")
+	if err != nil {
+		return err
+	}
+	return o.w.Ctl("show")
+}
+
+// Clear deletes everything in the window's body.
+func (o *OutputWindow) Clear() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	err := o.w.Replace(",", "")
+	if err != nil {
+		return err
+	}
+	return o.w.Ctl("clean")
+}
+
+// Close marks the window clean and releases its files. The window itself stays open.
+func (o *OutputWindow) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.w.Ctl("clean")
+	return o.w.Close()
+}
@@ -0,0 +1,53 @@
+package acmetools
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioctlGetTermios = unix.TIOCGETA
+	ioctlSetTermios = unix.TIOCSETA
+)
+
+// openPty opens a new pseudo-terminal, returning the controlling (master) side and the terminal
+// (slave) side.
+func openPty() (pty *os.File, tty *os.File, err error) {
+	pty, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var name [128]byte
+	err = control(pty, func(fd int) error {
+		if err := unix.IoctlSetInt(fd, unix.TIOCPTYGRANT, 0); err != nil {
+			return err
+		}
+		if err := unix.IoctlSetInt(fd, unix.TIOCPTYUNLK, 0); err != nil {
+			return err
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), unix.TIOCPTYGNAME, uintptr(unsafe.Pointer(&name[0])))
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+	if err != nil {
+		pty.Close()
+		return nil, nil, fmt.Errorf("Failed to unlock pty: %w", err)
+	}
+	if i := bytes.IndexByte(name[:], 0); i >= 0 {
+		tty, err = os.OpenFile(string(name[:i]), os.O_RDWR|syscall.O_NOCTTY, 0)
+	} else {
+		err = fmt.Errorf("Bad pty name.")
+	}
+	if err != nil {
+		pty.Close()
+		return nil, nil, err
+	}
+	return pty, tty, nil
+}
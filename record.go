@@ -0,0 +1,220 @@
+package acmetools
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// eventReader is what parseEvent needs to read an event.
+type eventReader interface {
+	io.ByteReader
+	ReadString(delim byte) (string, error)
+}
+
+// recordingReader keeps a copy of everything read through it in raw.
+type recordingReader struct {
+	*bufio.Reader
+	raw []byte
+}
+
+func (r *recordingReader) ReadByte() (byte, error) {
+	b, err := r.Reader.ReadByte()
+	if err == nil {
+		r.raw = append(r.raw, b)
+	}
+	return b, err
+}
+
+func (r *recordingReader) ReadString(delim byte) (string, error) {
+	s, err := r.Reader.ReadString(delim)
+	r.raw = append(r.raw, s...)
+	return s, err
+}
+
+// A Recorder saves a window's events exactly as acme sent them, along with snapshots of the
+// window's body, so they can be fed back through an EventStream later by a Replayer. See
+// Window.RecordEvents.
+//
+// A recording is a sequence of records. Each record is a header line holding a record type and a
+// byte count, followed by that many bytes of data and a newline. Records of type "b" hold the
+// complete body of the window, and records of type "e" hold one raw event. Each event is preceded
+// by a snapshot of the body taken as the event arrived.
+type Recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecorder returns a Recorder that writes a recording to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Event records a raw event, as read from a window's event file.
+func (r *Recorder) Event(raw []byte) error {
+	return r.write('e', raw)
+}
+
+// Body records a snapshot of a window's body.
+func (r *Recorder) Body(body []byte) error {
+	return r.write('b', body)
+}
+
+func (r *Recorder) write(kind byte, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := fmt.Fprintf(r.w, "%c %d\n%s\n", kind, len(data), data)
+	return err
+}
+
+// record saves a snapshot of the body and then the raw event to rec.
+func (w *Window) record(rec *Recorder, raw []byte) error {
+	f, err := w.c.Open(fmt.Sprintf("/%s/body", w.id), proto.Oread)
+	if err != nil {
+		return fmt.Errorf("Tried to open body file, but failed: %w", err)
+	}
+	defer f.Close()
+	body, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	err = rec.Body(body)
+	if err != nil {
+		return err
+	}
+	return rec.Event(raw)
+}
+
+// A Replayer feeds a recording made by a Recorder back through an EventStream.
+type Replayer struct {
+	r *bufio.Reader
+
+	mu     sync.Mutex
+	bodies map[*Event]string
+	wrote  bytes.Buffer
+}
+
+// NewReplayer returns a Replayer that reads a recording from r.
+func NewReplayer(r io.Reader) *Replayer {
+	return &Replayer{r: bufio.NewReader(r), bodies: make(map[*Event]string)}
+}
+
+// Events returns an EventStream that delivers the recorded events. The body snapshot recorded
+// with each event is available from Body.
+//
+// If w is not nil, the recording is played against a real acme: each snapshot is written into
+// w's body before its event is delivered, and events written back with WriteBack go to w's event
+// file. Otherwise written back events are collected for WrittenBack. The stream's channel is
+// unbuffered, so a snapshot is not written until the previous event has been received.
+func (p *Replayer) Events(w *Window) (*EventStream, error) {
+	var f io.ReadWriteCloser = &replayBuffer{p}
+	if w != nil {
+		ef, err := w.c.Open(fmt.Sprintf("/%s/event", w.id), proto.Ordwr)
+		if err != nil {
+			return nil, fmt.Errorf("Tried to open event file, but failed: %w", err)
+		}
+		f = ef
+	}
+	c := make(chan *Event)
+
+	go func() {
+		defer close(c)
+		var body string
+		for {
+			kind, data, err := p.next()
+			if err != nil {
+				if err != io.EOF {
+					log.Printf("Failed to read recording: %v", err)
+				}
+				return
+			}
+			switch kind {
+			case 'b':
+				body = string(data)
+				if w != nil {
+					err = w.Replace(",", string(data))
+					if err != nil {
+						log.Printf("Failed to replay body: %v", err)
+					}
+				}
+			case 'e':
+				e, err := parseEvent(bufio.NewReader(bytes.NewReader(data)))
+				if err != nil {
+					log.Printf("Failed to replay event: %v", err)
+					return
+				}
+				p.mu.Lock()
+				p.bodies[e] = body
+				p.mu.Unlock()
+				c <- e
+			}
+		}
+	}()
+
+	return &EventStream{C: c, f: f, w: w}, nil
+}
+
+// next reads the next record from the recording.
+func (p *Replayer) next() (byte, []byte, error) {
+	hdr, err := p.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && hdr != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	fields := strings.Fields(hdr)
+	if len(fields) != 2 || len(fields[0]) != 1 {
+		return 0, nil, fmt.Errorf("Bad record header %q", hdr)
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, nil, fmt.Errorf("Bad record header %q: %w", hdr, err)
+	}
+	data := make([]byte, n+1)
+	_, err = io.ReadFull(p.r, data)
+	if err != nil {
+		return 0, nil, err
+	}
+	return fields[0][0], data[:n], nil
+}
+
+// Body returns the body snapshot recorded with the replayed event e.
+func (p *Replayer) Body(e *Event) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.bodies[e]
+}
+
+// WrittenBack returns everything written back to an EventStream replayed without a window.
+func (p *Replayer) WrittenBack() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.wrote.String()
+}
+
+// replayBuffer stands in for the event file of a stream replayed without a window.
+type replayBuffer struct {
+	p *Replayer
+}
+
+func (b *replayBuffer) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (b *replayBuffer) Write(p []byte) (int, error) {
+	b.p.mu.Lock()
+	defer b.p.mu.Unlock()
+	return b.p.wrote.Write(p)
+}
+
+func (b *replayBuffer) Close() error {
+	return nil
+}
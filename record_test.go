@@ -0,0 +1,63 @@
+package acmetools
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var b bytes.Buffer
+	rec := NewRecorder(&b)
+	for _, r := range []struct {
+		body  string
+		event string
+	}{
+		{
+			body:  "hello\n",
+			event: "KI5 6 0 1 \n\n",
+		},
+		{
+			body:  "hello\n\t\n",
+			event: "MX0 4 1 4 Look\n",
+		},
+	} {
+		if err := rec.Body([]byte(r.body)); err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Event([]byte(r.event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := NewReplayer(&b)
+	es, err := p.Events(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-es.C
+	if e.Origin != EV_Keyboard || e.Type != ET_BodyInsert || e.StartAddr != 5 || e.S != "\n" {
+		t.Fatalf("Unexpected first event %s", e)
+	}
+	if body := p.Body(e); body != "hello\n" {
+		t.Fatalf("Expected body %q, but got %q", "hello\n", body)
+	}
+
+	e = <-es.C
+	if e.Origin != EV_Mouse || e.Type != ET_BodyBtn2 || e.S != "Look" {
+		t.Fatalf("Unexpected second event %s", e)
+	}
+	if body := p.Body(e); body != "hello\n\t\n" {
+		t.Fatalf("Expected body %q, but got %q", "hello\n\t\n", body)
+	}
+	if err := es.WriteBack(e); err != nil {
+		t.Fatal(err)
+	}
+	if wb := p.WrittenBack(); wb != "MX0 4\n" {
+		t.Fatalf("Expected write back %q, but got %q", "MX0 4\n", wb)
+	}
+
+	if e, ok := <-es.C; ok {
+		t.Fatalf("Expected end of stream, but got %s", e)
+	}
+}
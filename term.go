@@ -0,0 +1,301 @@
+//go:build linux || darwin
+
+package acmetools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"unicode/utf8"
+
+	"golang.org/x/sys/unix"
+)
+
+// Term connects a Window to a pseudo-terminal, in the style of win(1). Output from the terminal is
+// inserted into the body at the output point, and text typed after the output point is sent to
+// the terminal a line at a time.
+//
+// Term does not read the window's events itself. Whoever reads the EventStream should pass each
+// event to HandleEvent, and handle the event themselves if HandleEvent does not.
+type Term struct {
+	w   *Window
+	pty *os.File
+	tty *os.File
+
+	mu      sync.Mutex
+	q       int    // The output point, as a rune offset in the body.
+	partial []byte // An incomplete UTF-8 sequence left over from the last Write.
+	cmd     *exec.Cmd
+	tee     io.Writer
+}
+
+// NewTerm opens a pseudo-terminal and attaches it to w. The output point starts at the end of the
+// window's body.
+func NewTerm(w *Window) (*Term, error) {
+	ps, err := w.ReadCtl()
+	if err != nil {
+		return nil, err
+	}
+	pty, tty, err := openPty()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open pty: %w", err)
+	}
+	// The window already shows what was typed, and acme wants plain newlines.
+	err = control(tty, func(fd int) error {
+		tios, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+		if err != nil {
+			return err
+		}
+		tios.Lflag &^= unix.ECHO
+		tios.Oflag &^= unix.ONLCR
+		return unix.IoctlSetTermios(fd, ioctlSetTermios, tios)
+	})
+	if err != nil {
+		pty.Close()
+		tty.Close()
+		return nil, fmt.Errorf("Failed to set up pty: %w", err)
+	}
+	t := &Term{w: w, pty: pty, tty: tty, q: ps.BodyChars}
+	go t.readPty()
+	return t, nil
+}
+
+func (t *Term) readPty() {
+	bs := make([]byte, 8192)
+	for {
+		n, err := t.pty.Read(bs)
+		if n > 0 {
+			t.Write(bs[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// TTY returns the terminal side of the pseudo-terminal.
+func (t *Term) TTY() *os.File {
+	return t.tty
+}
+
+// Start starts cmd on the terminal. Any of cmd's Stdin, Stdout and Stderr that are nil are
+// connected to the terminal. If Stdin is connected to the terminal, cmd is started in a new
+// session with the terminal as its controlling terminal. Otherwise it is started in a new process
+// group. Either way, Kill will kill the whole group.
+func (t *Term) Start(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if cmd.Stdin == nil {
+		cmd.Stdin = t.tty
+		cmd.SysProcAttr.Setsid = true
+		cmd.SysProcAttr.Setctty = true
+		cmd.SysProcAttr.Ctty = 0
+	} else {
+		cmd.SysProcAttr.Setpgid = true
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = t.tty
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = t.tty
+	}
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.cmd = cmd
+	t.mu.Unlock()
+	return nil
+}
+
+// Write inserts p into the window at the output point, and moves the output point past it.
+func (t *Term) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(p)
+	bs := append(t.partial, p...)
+	// Hold back an incomplete rune at the end until the rest of it arrives, so the output point
+	// stays in step with acme's rune count.
+	end := len(bs)
+	for i := len(bs) - 1; i >= 0 && i >= len(bs)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(bs[i]) {
+			if !utf8.FullRune(bs[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	t.partial = append([]byte(nil), bs[end:]...)
+	bs = bs[:end]
+	if len(bs) == 0 {
+		return n, nil
+	}
+	err := t.w.Replace(fmt.Sprintf("#%d", t.q), string(bs))
+	if err != nil {
+		return 0, err
+	}
+	t.q += utf8.RuneCount(bs)
+	if t.tee != nil {
+		t.tee.Write(bs)
+	}
+	return n, t.w.Ctl("clean")
+}
+
+// Tee copies everything inserted into the window at the output point to w as well, including the
+// terminal's output. Errors writing to w are ignored.
+func (t *Term) Tee(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tee = w
+}
+
+// Send sends s to the terminal as though it had been typed after the output point.
+func (t *Term) Send(s string) error {
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	_, err := t.Write([]byte(s))
+	if err != nil {
+		return err
+	}
+	_, err = t.pty.Write([]byte(s))
+	return err
+}
+
+// Interrupt sends the terminal's interrupt character, as though ^C were typed.
+func (t *Term) Interrupt() error {
+	_, err := t.pty.Write([]byte{0x03})
+	return err
+}
+
+// EOF sends the terminal's end-of-file character, as though ^D were typed.
+func (t *Term) EOF() error {
+	_, err := t.pty.Write([]byte{0x04})
+	return err
+}
+
+// Kill kills the process group of the command started with Start.
+func (t *Term) Kill() error {
+	t.mu.Lock()
+	cmd := t.cmd
+	t.mu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		return fmt.Errorf("No process running.")
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// Wait waits for the command started with Start to exit.
+func (t *Term) Wait() error {
+	t.mu.Lock()
+	cmd := t.cmd
+	t.mu.Unlock()
+	if cmd == nil {
+		return fmt.Errorf("No process running.")
+	}
+	return cmd.Wait()
+}
+
+// HandleEvent handles the events a Term is interested in, and reports whether it handled e.
+//
+// Insertions and deletions by the keyboard or mouse move the output point. When a newline is typed
+// after the output point, the complete lines after the output point are sent to the terminal.
+// The Send, Intr, Eof and Kill commands send the body's selection followed by a newline, the
+// interrupt character, the end-of-file character, and kill the process group, respectively.
+// Events with expansions should be merged with their expansion before being passed to
+// HandleEvent.
+func (t *Term) HandleEvent(e *Event) (bool, error) {
+	switch e.Type {
+	case ET_BodyInsert, ET_BodyDelete:
+		if e.Origin != EV_Keyboard && e.Origin != EV_Mouse {
+			// Writes through the files, including our own, are accounted for by the writer.
+			return false, nil
+		}
+		return true, t.edited(e)
+	case ET_BodyBtn2, ET_TagBtn2:
+		switch e.S {
+		case "Send":
+			t.mu.Lock()
+			s, err := t.w.Selected()
+			t.mu.Unlock()
+			if err != nil {
+				return true, err
+			}
+			return true, t.Send(s)
+		case "Intr":
+			return true, t.Interrupt()
+		case "Eof":
+			return true, t.EOF()
+		case "Kill":
+			return true, t.Kill()
+		}
+	}
+	return false, nil
+}
+
+func (t *Term) edited(e *Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := e.EndAddr - e.StartAddr
+	if e.Type == ET_BodyDelete {
+		if e.StartAddr < t.q {
+			if e.EndAddr < t.q {
+				t.q -= n
+			} else {
+				t.q = e.StartAddr
+			}
+		}
+		return nil
+	}
+	if e.StartAddr < t.q {
+		t.q += n
+		return nil
+	}
+	if e.NChars > 0 && !strings.Contains(e.S, "\n") {
+		return nil
+	}
+	input, err := t.w.ReadAddr(fmt.Sprintf("#%d,$", t.q))
+	if err != nil {
+		return err
+	}
+	i := strings.LastIndex(input, "\n")
+	if i < 0 {
+		return nil
+	}
+	input = input[:i+1]
+	t.q += utf8.RuneCountInString(input)
+	_, err = t.pty.Write([]byte(input))
+	if err != nil {
+		return err
+	}
+	return t.w.Ctl("clean")
+}
+
+// Close closes the pseudo-terminal. It does not close the window.
+func (t *Term) Close() error {
+	t.tty.Close()
+	return t.pty.Close()
+}
+
+// control calls fn with f's file descriptor, without taking the file out of non-blocking mode the
+// way File.Fd does.
+func control(f *os.File, fn func(fd int) error) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	err = rc.Control(func(fd uintptr) {
+		ferr = fn(int(fd))
+	})
+	if err != nil {
+		return err
+	}
+	return ferr
+}